@@ -7,11 +7,14 @@ import (
 var convertCmd = &cobra.Command{
 	Use:   "convert",
 	Short: "file format conversions",
-	Long:  `Converting files from one format to another.`,
+	Long: `Converting files from one format to another. Used directly, the formats
+of both sides are worked out from the files.`,
+	RunE: runConvert,
 }
 
 func init() {
 	rootCmd.AddCommand(convertCmd)
+	addConvertFlags(convertCmd)
 
 	// Here you will define your flags and configuration settings.
 
@@ -7,11 +7,15 @@ import (
 var diffCmd = &cobra.Command{
 	Use:   "diff",
 	Short: "compare files, entry by entry",
-	Long:  `Find all the differences between two input files, and show them.`,
+	Long: `Find all the differences between two input files, and show them.
+Used directly, the formats of both files are worked out from the files.`,
+	Args: cobra.ExactArgs(2),
+	RunE: runDiff,
 }
 
 func init() {
 	rootCmd.AddCommand(diffCmd)
+	addDiffFlags(diffCmd)
 
 	// Here you will define your flags and configuration settings.
 
@@ -0,0 +1,65 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+
+	"github.com/asuffield/ouro-tools/pkg/gogen"
+	"github.com/asuffield/ouro-tools/pkg/staging"
+)
+
+var (
+	goPackage string
+	goOut     string
+)
+
+var generateCmd = &cobra.Command{
+	Use:   "generate",
+	Short: "code generation",
+	Long:  `Generating source code from message files.`,
+}
+
+var generateGoCmd = &cobra.Command{
+	Use:   "go <path>",
+	Short: "generate a Go package of message ids",
+	Long: `Reads messagestore files and writes a Go package with a constant for
+each message id, and a formatter with typed parameters for each message
+with variables.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		s := newStore()
+		s.BaseDir = filepath.Dir(args[0])
+		if err := readInput(s, args[0]); err != nil {
+			return fmt.Errorf("failed to read %s: %w", args[0], err)
+		}
+
+		src, err := gogen.Generate(s, goPackage)
+		if err != nil {
+			return err
+		}
+
+		if goOut == "" {
+			_, err := os.Stdout.Write(src)
+			return err
+		}
+		p := staging.NewPlan()
+		if err := p.Add(goOut, src, len(s.MessageIDs())); err != nil {
+			return err
+		}
+		if verbose {
+			p.Summary(os.Stdout)
+		}
+		return p.Commit()
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(generateCmd)
+	generateCmd.AddCommand(generateGoCmd)
+
+	generateGoCmd.Flags().StringVar(&goPackage, "package", "messages", "name of the generated package")
+	generateGoCmd.Flags().StringVar(&goOut, "out", "", "file to write to, instead of standard output")
+}
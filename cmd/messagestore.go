@@ -1,70 +1,219 @@
 package cmd
 
 import (
-	"crypto/sha256"
-	"encoding/hex"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
 	"path/filepath"
+	"regexp"
 	"sort"
 	"strings"
 
 	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
 
 	"github.com/asuffield/ouro-tools/pkg/messagestore"
+	"github.com/asuffield/ouro-tools/pkg/staging"
 )
 
 var (
-	from     string
-	template string
-	to       string
-	all      bool
+	from       string
+	template   string
+	to         string
+	all        bool
+	salvage    bool
+	layout     bool
+	raw        bool
+	manifest   string
+	dryRun     bool
+	backups    int
+	provenance bool
+	toTemplate string
 )
 
-func printSummary(s *messagestore.Store) {
-	h := sha256.New()
-	s.Hash(h, true)
-	fmt.Printf("content hash: %s\n", hex.EncodeToString(h.Sum(nil)))
-	fmt.Printf("%s\n", s.Summary())
+// newStore makes a store configured from the command line and config file
+func newStore() *messagestore.Store {
+	s := messagestore.NewStore()
+	s.Verbose = verbose
+
+	// Resource limits for decoding binary files, in case the defaults
+	// are too small for some real file
+	for key, limit := range map[string]*int{
+		"limits.max-strings":     &s.Limits.MaxStrings,
+		"limits.max-table-bytes": &s.Limits.MaxTableBytes,
+		"limits.max-messages":    &s.Limits.MaxMessages,
+		"limits.max-id-length":   &s.Limits.MaxIDLength,
+		"limits.max-vars":        &s.Limits.MaxVars,
+	} {
+		if viper.IsSet(key) {
+			*limit = viper.GetInt(key)
+		}
+	}
+
+	return s
+}
+
+// routes reads the rules for which file new messages go into from the
+// config file, e.g.
+//
+//	routes:
+//	  - match: ^ui_
+//	    file: ui/messages.txt
+func routes() ([]messagestore.Route, error) {
+	var rules []struct{ Match, File string }
+	if err := viper.UnmarshalKey("routes", &rules); err != nil {
+		return nil, fmt.Errorf("failed to read routes from config: %s", err)
+	}
+	routes := []messagestore.Route{}
+	for _, rule := range rules {
+		re, err := regexp.Compile(rule.Match)
+		if err != nil {
+			return nil, fmt.Errorf("failed to compile route %q: %s", rule.Match, err)
+		}
+		routes = append(routes, messagestore.Route{Match: re, File: rule.File})
+	}
+	return routes, nil
+}
+
+func printSummary(w io.Writer, s *messagestore.Store) {
+	fmt.Fprintf(w, "content hash: %s\n", s.ContentHash())
+	fmt.Fprintf(w, "%s\n", s.Summary())
+}
+
+// readInput reads a file or directory, or standard input for "-"
+func readInput(s *messagestore.Store, path string) error {
+	if path == "-" {
+		return s.ReadStream(os.Stdin, path)
+	}
+	return s.Read(path)
 }
 
 var messagestoreConvertCmd = &cobra.Command{
 	Use:   "messagestore",
 	Short: "convert to/from the messagestore format",
 	Long:  `Reads and writes messagestore text and binary files.`,
-	RunE: func(cmd *cobra.Command, args []string) error {
-		if from == "" || to == "" {
-			return fmt.Errorf("--from and --to are required")
+	RunE:  runConvert,
+}
+
+func runConvert(cmd *cobra.Command, args []string) error {
+	if to == "" && toTemplate != "" {
+		// A rendered template goes to standard output unless it's given a file
+		to = "-"
+	}
+	if from == "" || to == "" {
+		return fmt.Errorf("--from and --to are required")
+	}
+
+	// Binary goes to standard output for "-", so everything else
+	// goes to standard error
+	info := io.Writer(os.Stdout)
+	if to == "-" {
+		info = os.Stderr
+	}
+
+	s := newStore()
+	s.BaseDir = filepath.Dir(from)
+	s.Salvage = salvage
+	s.Provenance = provenance
+	s.Verbose = s.Verbose && to != "-"
+	r, err := routes()
+	if err != nil {
+		return err
+	}
+	s.Routes = r
+
+	if err := readInput(s, from); err != nil {
+		return fmt.Errorf("failed to read %s: %w", from, err)
+	}
+
+	if damage := s.Damage(); len(damage) > 0 {
+		fmt.Fprintf(info, "Salvaged %d messages from %s, but:\n", len(s.MessageIDs()), from)
+		for _, d := range damage {
+			fmt.Fprintf(info, "  %s\n", d)
 		}
+	}
+
+	if verbose {
+		fmt.Fprintf(info, "Input data:\n")
+		printSummary(info, s)
+	}
 
-		s := messagestore.NewStore()
-		s.Verbose = verbose
-		s.BaseDir = filepath.Dir(from)
+	if toTemplate != "" {
+		if to == "-" {
+			if dryRun {
+				return nil
+			}
+			data, err := s.ExecuteTemplate(toTemplate)
+			if err != nil {
+				return err
+			}
+			_, err = os.Stdout.Write(data)
+			return err
+		}
+		p, err := s.PlanTemplate(to, toTemplate)
+		if err != nil {
+			return err
+		}
+		return commitPlan(p)
+	}
 
-		if err := s.Read(from); err != nil {
-			return fmt.Errorf("failed to read %s: %s", from, err)
+	if to == "-" {
+		if dryRun {
+			return nil
 		}
+		e := messagestore.NewEncoder(os.Stdout)
+		e.Name = "standard output"
+		return e.Encode(s)
+	}
 
+	var t *messagestore.Store
+	if template != "" {
+		t = newStore()
+		t.BaseDir = filepath.Dir(template)
+		if err := t.Read(template); err != nil {
+			return fmt.Errorf("failed to read %s: %w", template, err)
+		}
 		if verbose {
-			fmt.Printf("Input data:\n")
-			printSummary(s)
+			fmt.Printf("Template:\n")
+			printSummary(os.Stdout, t)
 		}
+	}
 
-		var t *messagestore.Store
-		if template != "" {
-			t = messagestore.NewStore()
-			t.Verbose = verbose
-			t.BaseDir = filepath.Dir(template)
-			if err := t.Read(template); err != nil {
-				return fmt.Errorf("failed to read %s: %s", template, err)
-			}
-			if verbose {
-				fmt.Printf("Template:\n")
-				printSummary(t)
-			}
+	var p *staging.Plan
+	if manifest != "" && s.Binary() {
+		if t != nil {
+			return fmt.Errorf("--manifest and --template can't both be used with binary input")
 		}
+		m, err := messagestore.ReadManifest(manifest)
+		if err != nil {
+			return err
+		}
+		p, err = s.PlanTextManifest(to, m)
+	} else {
+		p, err = s.PlanWrite(to, t)
+	}
+	if err != nil {
+		return err
+	}
+	if manifest != "" && !s.Binary() {
+		if err := s.PlanManifest(p, manifest); err != nil {
+			return err
+		}
+	}
+	return commitPlan(p)
+}
 
-		return s.Write(to, t)
-	},
+// commitPlan writes the files in p, as asked on the command line
+func commitPlan(p *staging.Plan) error {
+	p.Backups = backups
+	if dryRun || verbose {
+		p.Summary(os.Stdout)
+	}
+	if dryRun {
+		return nil
+	}
+	return p.Commit()
 }
 
 func formatMessage(s *messagestore.Store, id string) string {
@@ -89,29 +238,50 @@ var messagestoreShowCmd = &cobra.Command{
 	Short: "dump the messagestore format",
 	Long:  `Reads messagestore text and binary files.`,
 	Args:  cobra.ExactArgs(1),
-	RunE: func(cmd *cobra.Command, args []string) error {
-		s := messagestore.NewStore()
-		s.Verbose = verbose
+	RunE:  runShow,
+}
 
-		if err := s.Read(args[0]); err != nil {
-			return fmt.Errorf("failed to read %s: %s", args[0], err)
-		}
+func runShow(cmd *cobra.Command, args []string) error {
+	if layout {
+		return showLayout(args[0])
+	}
 
-		if verbose {
-			fmt.Printf("Input data:\n")
-			printSummary(s)
-		}
+	s := newStore()
+	s.Lazy = true
+	defer s.Close()
 
-		if all {
-			args = s.MessageIDs()
-			sort.Strings(args)
-		}
-		for _, id := range args {
-			fmt.Printf("%s\n", formatMessage(s, id))
-		}
+	if err := readInput(s, args[0]); err != nil {
+		return fmt.Errorf("failed to read %s: %w", args[0], err)
+	}
 
-		return nil
-	},
+	if verbose {
+		fmt.Printf("Input data:\n")
+		printSummary(os.Stdout, s)
+	}
+
+	if all {
+		args = s.MessageIDs()
+		sort.Strings(args)
+	}
+	for _, id := range args {
+		fmt.Printf("%s\n", formatMessage(s, id))
+	}
+
+	return nil
+}
+
+func showLayout(path string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	l, err := newStore().ReadLayout(data, path)
+	l.Dump(os.Stdout, data)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	return nil
 }
 
 var messagestoreDiffCmd = &cobra.Command{
@@ -119,67 +289,180 @@ var messagestoreDiffCmd = &cobra.Command{
 	Short: "diff two files in the messagestore format",
 	Long:  `Diffs messagestore files.`,
 	Args:  cobra.ExactArgs(2),
+	RunE:  runDiff,
+}
+
+func runDiff(cmd *cobra.Command, args []string) error {
+	if raw {
+		return diffRaw(args[0], args[1])
+	}
+
+	a := newStore()
+	b := newStore()
+	a.Lazy = true
+	b.Lazy = true
+	defer a.Close()
+	defer b.Close()
+	if err := readInput(a, args[0]); err != nil {
+		return fmt.Errorf("failed to read %s: %w", args[0], err)
+	}
+	if err := readInput(b, args[1]); err != nil {
+		return fmt.Errorf("failed to read %s: %w", args[1], err)
+	}
+
+	if verbose {
+		fmt.Printf("Input data:\n")
+		printSummary(os.Stdout, a)
+		printSummary(os.Stdout, b)
+	}
+
+	idsA := a.MessageIDs()
+	idsB := b.MessageIDs()
+	sort.Strings(idsA)
+	sort.Strings(idsB)
+
+	var i, j int
+	for i < len(idsA) && j < len(idsB) {
+		if i > len(idsA) || idsA[i] > idsB[j] {
+			fmt.Printf("+%s: %s\n", idsB[j], b.Message(idsB[j]))
+			j += 1
+		} else if j > len(idsB) || idsA[i] < idsB[j] {
+			fmt.Printf("-%s: %s\n", idsA[i], a.Message(idsA[i]))
+			i += 1
+		} else {
+			id := idsA[i]
+			if id != idsB[j] {
+				panic("bug in diff algorithm")
+			}
+			aMsg := formatMessage(a, id)
+			bMsg := formatMessage(b, id)
+			if aMsg != bMsg {
+				fmt.Printf("-%s\n", aMsg)
+				fmt.Printf("+%s\n", bMsg)
+			}
+			i += 1
+			j += 1
+		}
+	}
+
+	return nil
+}
+
+func diffRaw(pathA, pathB string) error {
+	dataA, err := ioutil.ReadFile(pathA)
+	if err != nil {
+		return err
+	}
+	dataB, err := ioutil.ReadFile(pathB)
+	if err != nil {
+		return err
+	}
+
+	a := newStore()
+	b := newStore()
+	la, err := a.ReadLayout(dataA, pathA)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", pathA, err)
+	}
+	lb, err := b.ReadLayout(dataB, pathB)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", pathB, err)
+	}
+
+	messagestore.RawDiff(os.Stdout, a, b, la, lb, dataA, dataB)
+	return nil
+}
+
+var messagestoreVerifyCmd = &cobra.Command{
+	Use:   "messagestore <path>",
+	Short: "check that messagestore text files convert losslessly",
+	Long:  `Checks that a messagestore text tree is written back out exactly, and that every message and its types survive conversion to binary and back.`,
+	Args:  cobra.ExactArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
-		a := messagestore.NewStore()
-		b := messagestore.NewStore()
-		a.Verbose = verbose
-		b.Verbose = verbose
-		if err := a.Read(args[0]); err != nil {
-			return fmt.Errorf("failed to read %s: %s", args[0], err)
+		// The round trip writes text using the input as the template
+		format, err := messagestore.DetectFormat(args[0])
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", args[0], err)
 		}
-		if err := b.Read(args[1]); err != nil {
-			return fmt.Errorf("failed to read %s: %s", args[1], err)
+		if format.Name() != "text" {
+			return fmt.Errorf("can only verify text trees, %s is %s", args[0], format.Name())
 		}
 
-		if verbose {
-			fmt.Printf("Input data:\n")
-			printSummary(a)
-			printSummary(b)
-		}
-
-		idsA := a.MessageIDs()
-		idsB := b.MessageIDs()
-		sort.Strings(idsA)
-		sort.Strings(idsB)
-
-		var i, j int
-		for i < len(idsA) && j < len(idsB) {
-			if i > len(idsA) || idsA[i] > idsB[j] {
-				fmt.Printf("+%s: %s\n", idsB[j], b.Message(idsB[j]))
-				j += 1
-			} else if j > len(idsB) || idsA[i] < idsB[j] {
-				fmt.Printf("-%s: %s\n", idsA[i], a.Message(idsA[i]))
-				i += 1
-			} else {
-				id := idsA[i]
-				if id != idsB[j] {
-					panic("bug in diff algorithm")
-				}
-				aMsg := formatMessage(a, id)
-				bMsg := formatMessage(b, id)
-				if aMsg != bMsg {
-					fmt.Printf("-%s\n", aMsg)
-					fmt.Printf("+%s\n", bMsg)
-				}
-				i += 1
-				j += 1
+		s := newStore()
+		s.BaseDir = filepath.Dir(args[0])
+		if err := s.Read(args[0]); err != nil {
+			return fmt.Errorf("failed to read %s: %w", args[0], err)
+		}
+
+		mismatches, err := s.CheckLossless()
+		if err != nil {
+			return err
+		}
+		for _, m := range mismatches {
+			fmt.Printf("%s\n", m)
+		}
+
+		stages, err := s.RoundTrip(args[0])
+		changed := 0
+		hash := s.ContentHash()
+		for _, stage := range stages {
+			fmt.Printf("%s: content hash %s\n", stage.Name, stage.Store.ContentHash())
+			if stage.Store.ContentHash() != hash {
+				changed++
 			}
+			for _, c := range s.Changes(stage.Store) {
+				fmt.Printf("  %s\n", c)
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("failed to convert %s: %w", args[0], err)
 		}
 
+		if len(mismatches) > 0 {
+			return fmt.Errorf("%d files would not be written back unchanged", len(mismatches))
+		}
+		if changed > 0 {
+			return fmt.Errorf("content hash changed in %d stages of conversion", changed)
+		}
 		return nil
 	},
 }
 
+// The same flags are on the format specific commands and the generic
+// ones, which work out the formats themselves
+func addConvertFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&from, "from", "", "file/directories to read from, or - for standard input")
+	cmd.Flags().StringVar(&template, "template", "", "file/directories to use as a template for writing")
+	cmd.Flags().StringVar(&to, "to", "", "file/directory to write to, or - for binary on standard output")
+	cmd.Flags().BoolVar(&salvage, "salvage", false, "recover what can be read from a damaged binary file")
+	cmd.Flags().IntVar(&backups, "backup", 0, "keep this many generations of backups of the files written")
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "list the files which would be written, without writing them")
+	cmd.Flags().BoolVar(&provenance, "provenance", false, "include where each message was defined, in formats which can hold it")
+	cmd.Flags().StringVar(&toTemplate, "to-template", "", "text/template to render the messages with, instead of writing a format, to --to or else standard output")
+	cmd.Flags().StringVar(&manifest, "manifest", "", "layout manifest to write when converting from text, or to rebuild the text tree from when converting from binary")
+}
+
+func addShowFlags(cmd *cobra.Command) {
+	cmd.Flags().BoolVar(&all, "all", false, "show all messages in store")
+	cmd.Flags().BoolVar(&layout, "layout", false, "show an annotated hex dump of a binary file")
+}
+
+func addDiffFlags(cmd *cobra.Command) {
+	cmd.Flags().BoolVar(&raw, "raw", false, "compare the structure of two binary files")
+}
+
 func init() {
 	convertCmd.AddCommand(messagestoreConvertCmd)
 
-	messagestoreConvertCmd.Flags().StringVar(&from, "from", "", "file/directories to read from")
-	messagestoreConvertCmd.Flags().StringVar(&template, "template", "", "file/directories to use as a template for writing")
-	messagestoreConvertCmd.Flags().StringVar(&to, "to", "", "file/directory to write to")
+	addConvertFlags(messagestoreConvertCmd)
 
 	showCmd.AddCommand(messagestoreShowCmd)
 
-	messagestoreShowCmd.Flags().BoolVar(&all, "all", false, "show all messages in store")
+	addShowFlags(messagestoreShowCmd)
 
 	diffCmd.AddCommand(messagestoreDiffCmd)
+
+	addDiffFlags(messagestoreDiffCmd)
+
+	verifyCmd.AddCommand(messagestoreVerifyCmd)
 }
@@ -0,0 +1,73 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Rendering a template goes to standard output unless --to gives a file
+func TestConvertToTemplate(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"main.txt":  "\"hello\" \"Hello\"\n\"bye\" \"Bye\"\n",
+		"good.tmpl": "{{range .Messages}}{{.ID}}={{.Text}};{{end}}",
+		"bad.tmpl":  "{{.Missing}}",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	stdout := os.Stdout
+	defer func() {
+		os.Stdout = stdout
+		from, to, toTemplate = "", "", ""
+	}()
+
+	for _, tc := range []struct {
+		name, to, tmpl string
+		err            bool
+		want           string
+	}{
+		{"stdout", "", "good.tmpl", false, "bye=Bye;hello=Hello;"},
+		{"dash", "-", "good.tmpl", false, "bye=Bye;hello=Hello;"},
+		{"file", "out.txt", "good.tmpl", false, ""},
+		{"error", "", "bad.tmpl", true, ""},
+		{"file error", "out.txt", "bad.tmpl", true, ""},
+	} {
+		out, err := os.Create(filepath.Join(t.TempDir(), "stdout"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		os.Stdout = out
+		from, to, toTemplate = filepath.Join(dir, "main.txt"), "", filepath.Join(dir, tc.tmpl)
+		target := ""
+		if tc.to != "" {
+			to = tc.to
+			if tc.to != "-" {
+				target = filepath.Join(t.TempDir(), tc.to)
+				to = target
+			}
+		}
+
+		err = runConvert(nil, nil)
+		os.Stdout = stdout
+		out.Close()
+		if (err != nil) != tc.err {
+			t.Errorf("%s: got error %v", tc.name, err)
+		}
+		written, _ := os.ReadFile(out.Name())
+		if string(written) != tc.want {
+			t.Errorf("%s: wrote %q to standard output, want %q", tc.name, written, tc.want)
+		}
+		if target != "" {
+			got, err := os.ReadFile(target)
+			if tc.err && err == nil {
+				t.Errorf("%s: wrote %s anyway", tc.name, target)
+			} else if !tc.err && string(got) != "bye=Bye;hello=Hello;" {
+				t.Errorf("%s: wrote %q, %v", tc.name, got, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,36 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/asuffield/ouro-tools/pkg/staging"
+)
+
+var restoreCmd = &cobra.Command{
+	Use:   "restore <path>",
+	Short: "roll back to the previous backup",
+	Long:  `Restores a file, or every file under a directory, from the newest .bak backup made by convert --backup. Files which that convert created are removed.`,
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		restored, removed, err := staging.Restore(args[0])
+		for _, path := range restored {
+			fmt.Printf("restored %s\n", path)
+		}
+		for _, path := range removed {
+			fmt.Printf("removed %s\n", path)
+		}
+		if err != nil {
+			return err
+		}
+		if len(restored)+len(removed) == 0 {
+			return fmt.Errorf("no backups found in %s", args[0])
+		}
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(restoreCmd)
+}
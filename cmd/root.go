@@ -1,11 +1,15 @@
 package cmd
 
 import (
+	"errors"
 	"fmt"
 	"os"
 
 	"github.com/spf13/cobra"
 
+	"github.com/asuffield/ouro-tools/pkg/messagestore"
+	"github.com/asuffield/ouro-tools/pkg/messagestore/parse"
+
 	homedir "github.com/mitchellh/go-homedir"
 	"github.com/spf13/viper"
 )
@@ -30,9 +34,30 @@ It provides file format conversions.`,
 // This is called by main.main(). It only needs to happen once to the rootCmd.
 func Execute() {
 	if err := rootCmd.Execute(); err != nil {
-		fmt.Println(err)
-		os.Exit(1)
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(exitCode(err))
+	}
+}
+
+// exitCode tells scripts what kind of problem stopped the command
+func exitCode(err error) int {
+	var pe *parse.ParseError
+	var de *messagestore.DecodeError
+	switch {
+	case errors.As(err, &pe):
+		return 2
+	case errors.Is(err, messagestore.ErrBadSignature):
+		return 3
+	case errors.Is(err, messagestore.ErrTruncated):
+		return 4
+	case errors.Is(err, messagestore.ErrIndexOutOfRange):
+		return 5
+	case errors.Is(err, messagestore.ErrLimitExceeded):
+		return 6
+	case errors.As(err, &de):
+		return 7
 	}
+	return 1
 }
 
 func init() {
@@ -59,7 +84,7 @@ func initConfig() {
 		// Find home directory.
 		home, err := homedir.Dir()
 		if err != nil {
-			fmt.Println(err)
+			fmt.Fprintln(os.Stderr, err)
 			os.Exit(1)
 		}
 
@@ -72,6 +97,7 @@ func initConfig() {
 
 	// If a config file is found, read it in.
 	if err := viper.ReadInConfig(); err == nil {
-		fmt.Println("Using config file:", viper.ConfigFileUsed())
+		// Not stdout, which might be carrying binary output
+		fmt.Fprintln(os.Stderr, "Using config file:", viper.ConfigFileUsed())
 	}
 }
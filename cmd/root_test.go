@@ -0,0 +1,97 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/asuffield/ouro-tools/pkg/messagestore"
+)
+
+// u32s builds a binary file by hand
+func u32s(values ...interface{}) []byte {
+	var b bytes.Buffer
+	for _, v := range values {
+		switch v := v.(type) {
+		case int:
+			binary.Write(&b, binary.LittleEndian, uint32(v))
+		case string:
+			b.WriteString(v)
+		}
+	}
+	return b.Bytes()
+}
+
+func TestExitCode(t *testing.T) {
+	sig := messagestore.BinarySignature
+	for name, tc := range map[string]struct {
+		data []byte
+		code int
+	}{
+		"bad.txt":       {[]byte("\"a\" \"A\"\njunk\n"), 2},
+		"signature.bin": {u32s(12345, 0, 0), 3},
+		"truncated.bin": {u32s(sig, 1, 3, "hi"), 4},
+		"index.bin":     {u32s(sig, 1, 3, "hi\x00", 0, 0, 1, 2, "id", 5, 0, 0), 5},
+		"limit.bin":     {u32s(sig, 0xffffffff, 0), 6},
+		"malformed.bin": {u32s(sig, 5, 2, "a\x00"), 7},
+	} {
+		path := filepath.Join(t.TempDir(), name)
+		if err := os.WriteFile(path, tc.data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		err := readInput(newStore(), path)
+		if err == nil {
+			t.Errorf("%s: no error", name)
+			continue
+		}
+		// Commands add context to the errors they return
+		err = fmt.Errorf("failed to read %s: %w", path, err)
+		if got := exitCode(err); got != tc.code {
+			t.Errorf("%s: exit code %d, want %d for %s", name, got, tc.code, err)
+		}
+	}
+
+	if got := exitCode(fmt.Errorf("--from and --to are required")); got != 1 {
+		t.Errorf("exit code %d for a usage error, want 1", got)
+	}
+}
+
+// "-" reads standard input, in either format
+func TestReadInputStdin(t *testing.T) {
+	text := newStore()
+	if err := text.ReadStream(bytes.NewReader([]byte("\"hello\" \"Hello\"\n")), "text"); err != nil {
+		t.Fatal(err)
+	}
+	var bin bytes.Buffer
+	if err := messagestore.NewEncoder(&bin).Encode(text); err != nil {
+		t.Fatal(err)
+	}
+
+	stdin := os.Stdin
+	defer func() { os.Stdin = stdin }()
+	for name, data := range map[string][]byte{
+		"text":   []byte("\"hello\" \"Hello\"\n"),
+		"binary": bin.Bytes(),
+	} {
+		path := filepath.Join(t.TempDir(), "stdin")
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		os.Stdin = f
+
+		s := newStore()
+		if err := readInput(s, "-"); err != nil {
+			t.Errorf("%s: %s", name, err)
+		} else if s.Message("hello") != "Hello" || s.Binary() != (name == "binary") {
+			t.Errorf("%s: read %v", name, s.MessageIDs())
+		}
+		f.Close()
+	}
+}
@@ -7,11 +7,15 @@ import (
 var showCmd = &cobra.Command{
 	Use:   "show",
 	Short: "file format inspection",
-	Long:  `Printing contents of files.`,
+	Long: `Printing contents of files. Used directly, the format of the file is
+worked out from the file.`,
+	Args: cobra.ExactArgs(1),
+	RunE: runShow,
 }
 
 func init() {
 	rootCmd.AddCommand(showCmd)
+	addShowFlags(showCmd)
 
 	// Here you will define your flags and configuration settings.
 
@@ -0,0 +1,15 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+)
+
+var verifyCmd = &cobra.Command{
+	Use:   "verify",
+	Short: "file format checks",
+	Long:  `Checking that files survive being read and written.`,
+}
+
+func init() {
+	rootCmd.AddCommand(verifyCmd)
+}
@@ -6,4 +6,5 @@ require (
 	github.com/spf13/cobra v0.0.5
 	github.com/spf13/viper v1.4.0
 	golang.org/x/text v0.3.0
+	gopkg.in/yaml.v2 v2.2.2
 )
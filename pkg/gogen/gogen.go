@@ -0,0 +1,178 @@
+package gogen
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"go/token"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/asuffield/ouro-tools/pkg/messagestore"
+)
+
+// Generate writes the source of a Go package which has a constant for
+// each message id, and a formatter for each message with variables which
+// takes them as typed parameters, so that leaving one out is a compile
+// error.
+func Generate(s *messagestore.Store, pkg string) ([]byte, error) {
+	if !token.IsIdentifier(pkg) {
+		return nil, fmt.Errorf("%q is not a valid package name", pkg)
+	}
+
+	ids := s.MessageIDs()
+	sort.Strings(ids)
+
+	// Everything is in one namespace, so the formatters can't collide
+	// with the constants
+	used := map[string]bool{"Messages": true}
+	consts := map[string]string{}
+	for _, id := range ids {
+		consts[id] = unique(used, exported(id))
+	}
+
+	var b bytes.Buffer
+	imports := map[string]bool{}
+	for _, id := range ids {
+		vars := s.MessageVars(id)
+		if len(vars) == 0 {
+			continue
+		}
+		name := unique(used, "Format"+consts[id])
+
+		// The parameter names mustn't hide anything the body uses
+		params := map[string]bool{"m": true, "fmt": true, "strings": true}
+		seen := map[string]bool{}
+		sig := []string{"m Messages"}
+		replace := []string{}
+		for _, v := range vars {
+			if seen[v.Name] {
+				continue
+			}
+			seen[v.Name] = true
+			param := unique(params, unexported(v.Name))
+			ty, value := goType(v.Ty, param)
+			if value != param {
+				imports["fmt"] = true
+			}
+			sig = append(sig, fmt.Sprintf("%s %s", param, ty))
+			replace = append(replace, fmt.Sprintf("%q, %s", "{"+v.Name+"}", value))
+		}
+		imports["strings"] = true
+
+		fmt.Fprintf(&b, "\n// %s fills in the variables of %s\n", name, consts[id])
+		fmt.Fprintf(&b, "func %s(%s) string {\n", name, strings.Join(sig, ", "))
+		fmt.Fprintf(&b, "\treturn strings.NewReplacer(%s).Replace(m.Message(%s))\n", strings.Join(replace, ", "), consts[id])
+		fmt.Fprintf(&b, "}\n")
+	}
+
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "// Code generated by ouro-tools generate go; DO NOT EDIT.\n\n")
+	fmt.Fprintf(&out, "package %s\n\n", pkg)
+	if len(imports) > 0 {
+		names := []string{}
+		for name := range imports {
+			names = append(names, fmt.Sprintf("%q", name))
+		}
+		sort.Strings(names)
+		fmt.Fprintf(&out, "import (\n%s\n)\n\n", strings.Join(names, "\n"))
+	}
+	fmt.Fprintf(&out, "// Messages looks up the text of a message, as *messagestore.Store does\n")
+	fmt.Fprintf(&out, "type Messages interface {\n\tMessage(id string) string\n}\n\n")
+	if len(ids) > 0 {
+		fmt.Fprintf(&out, "const (\n")
+		for _, id := range ids {
+			fmt.Fprintf(&out, "\t// %s\n", summary(s.Message(id)))
+			fmt.Fprintf(&out, "\t%s = %q\n", consts[id], id)
+		}
+		fmt.Fprintf(&out, ")\n")
+	}
+	out.Write(b.Bytes())
+
+	src, err := format.Source(out.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("failed to format generated code: %s", err)
+	}
+	return src, nil
+}
+
+// goType gives the Go type for a message variable type, and how to turn
+// param into a string
+func goType(ty, param string) (string, string) {
+	switch strings.ToLower(strings.TrimSpace(ty)) {
+	case "string", "str":
+		return "string", param
+	case "int", "integer":
+		return "int", fmt.Sprintf("fmt.Sprint(%s)", param)
+	case "float", "number":
+		return "float64", fmt.Sprintf("fmt.Sprint(%s)", param)
+	case "bool", "boolean":
+		return "bool", fmt.Sprintf("fmt.Sprint(%s)", param)
+	}
+	return "interface{}", fmt.Sprintf("fmt.Sprint(%s)", param)
+}
+
+// words splits an id into the runs of letters and digits in it
+func words(id string) []string {
+	return strings.FieldsFunc(id, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// exported makes a CamelCase identifier from an id, e.g. v_hello is VHello
+func exported(id string) string {
+	var b strings.Builder
+	for _, w := range words(id) {
+		r := []rune(w)
+		b.WriteString(strings.ToUpper(string(r[0])) + string(r[1:]))
+	}
+	name := b.String()
+	if name == "" || !unicode.IsUpper([]rune(name)[0]) {
+		name = "M" + name
+	}
+	return name
+}
+
+// unexported makes a lowerCamel identifier from a variable name
+func unexported(name string) string {
+	var b strings.Builder
+	for i, w := range words(name) {
+		r := []rune(w)
+		if i == 0 {
+			b.WriteString(strings.ToLower(w))
+		} else {
+			b.WriteString(strings.ToUpper(string(r[0])) + string(r[1:]))
+		}
+	}
+	name = b.String()
+	if name == "" || !unicode.IsLetter([]rune(name)[0]) || token.IsKeyword(name) {
+		name = "v" + exported(name)
+	}
+	return name
+}
+
+// unique adds a number to name if it is already used, and then marks it
+// as used
+func unique(used map[string]bool, name string) string {
+	candidate := name
+	for i := 2; used[candidate]; i++ {
+		candidate = fmt.Sprintf("%s%d", name, i)
+	}
+	used[candidate] = true
+	return candidate
+}
+
+// summary is the first line of a message, short enough for a comment
+func summary(text string) string {
+	line := strings.TrimSpace(strings.SplitN(text, "\n", 2)[0])
+	if r := []rune(line); len(r) > 60 {
+		line = string(r[:60]) + "..."
+	} else if strings.Contains(text, "\n") {
+		line += " ..."
+	}
+	if line == "" {
+		return "(empty)"
+	}
+	return line
+}
@@ -0,0 +1,84 @@
+package gogen
+
+import (
+	"go/ast"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/asuffield/ouro-tools/pkg/messagestore"
+)
+
+func readStore(t *testing.T, text, types string) *messagestore.Store {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range map[string]string{"main.txt": text + "import sub.txt types.txt\n", "sub.txt": "", "types.txt": types} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s := messagestore.NewStore()
+	s.BaseDir = dir
+	if err := s.Read(filepath.Join(dir, "main.txt")); err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+// Importing from source is slow, so the standard library is only
+// imported once
+var (
+	fset = token.NewFileSet()
+	std  = importer.ForCompiler(fset, "source", nil)
+)
+
+// compile type checks the generated source, and returns the package
+func compile(t *testing.T, src []byte) *types.Package {
+	t.Helper()
+	f, err := parser.ParseFile(fset, "messages.go", src, 0)
+	if err != nil {
+		t.Fatalf("generated code doesn't parse: %s\n%s", err, src)
+	}
+	conf := types.Config{Importer: std}
+	pkg, err := conf.Check("messages", fset, []*ast.File{f}, nil)
+	if err != nil {
+		t.Fatalf("generated code doesn't compile: %s\n%s", err, src)
+	}
+	return pkg
+}
+
+// Each type of variable, alone, needs the right imports
+func TestGenerateCompiles(t *testing.T) {
+	for _, ty := range []string{"string", "int", "float", "bool", "date", "STR", "Integer"} {
+		s := readStore(t, "\"hello\" \"Hello {x}\"\n\"plain\" \"Plain\"\n", "\"hello\" {x,"+ty+"}\n")
+		src, err := Generate(s, "messages")
+		if err != nil {
+			t.Fatalf("%s: %s", ty, err)
+		}
+		pkg := compile(t, src)
+		if pkg.Scope().Lookup("FormatHello") == nil || pkg.Scope().Lookup("Plain") == nil {
+			t.Errorf("%s: missing declarations in\n%s", ty, src)
+		}
+	}
+}
+
+// Names which clash with each other, with keywords or with what the
+// generated code uses still compile
+func TestGenerateNames(t *testing.T) {
+	s := readStore(t,
+		"\"a_b\" \"{fmt} {m} {type} {strings} {fmt}\"\n\"aB\" \"x\"\n\"FormatAB\" \"y\"\n\"Messages\" \"z\"\n\"1st\" \"{1}\"\n",
+		"\"a_b\" {fmt,int} {m,string} {type,bool} {strings,float} {fmt,int}\n\"1st\" {1,int}\n")
+	src, err := Generate(s, "messages")
+	if err != nil {
+		t.Fatal(err)
+	}
+	compile(t, src)
+
+	if _, err := Generate(s, "not valid"); err == nil {
+		t.Errorf("accepted an invalid package name")
+	}
+}
@@ -0,0 +1,179 @@
+package messagestore
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/asuffield/ouro-tools/pkg/messagestore/parse"
+	"github.com/asuffield/ouro-tools/pkg/staging"
+)
+
+// Spreadsheets, for translators. Each row is a message, with the columns
+// in csvColumns. Source and translation work like msgid and msgstr in
+// po.go. Spreadsheets only keep \n, so text which had \r\n line endings
+// is marked as crlf to get them back, and text which mixes the two
+// can't be written.
+type csvFormat struct{}
+
+func init() {
+	RegisterFormat(csvFormat{})
+}
+
+var csvColumns = []string{"id", "source", "translation", "types", "file", "newlines"}
+
+func (csvFormat) Name() string {
+	return "csv"
+}
+
+func (csvFormat) Detect(path string, head []byte) bool {
+	return strings.HasSuffix(path, ".csv")
+}
+
+func (csvFormat) Write(p *staging.Plan, s *Store, path string, template *Store) error {
+	source := s
+	if template != nil {
+		source = template
+	}
+
+	var b bytes.Buffer
+	// So that spreadsheets know it's UTF-8
+	b.WriteString("\uFEFF")
+	w := csv.NewWriter(&b)
+	w.Write(csvColumns)
+
+	ids := s.MessageIDs()
+	source.sourceOrder(ids)
+	for _, id := range ids {
+		text, translation := s.Message(id), ""
+		if template != nil && template.HasMessage(id) {
+			text, translation = template.Message(id), s.Message(id)
+		}
+		if translation == text {
+			translation = ""
+		}
+
+		newlines, err := csvNewlines(text, translation)
+		if err != nil {
+			return fmt.Errorf("can't write %s to %s: %s", id, path, err)
+		}
+		if newlines == "crlf" {
+			text = strings.ReplaceAll(text, "\r\n", "\n")
+			translation = strings.ReplaceAll(translation, "\r\n", "\n")
+		}
+
+		pos, _ := source.MessageDefinition(id)
+		w.Write([]string{id, text, translation, formatVars(s.MessageVars(id)), pos.File, newlines})
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return fmt.Errorf("failed to write %s: %s", path, err)
+	}
+
+	return p.Add(path, b.Bytes(), len(ids))
+}
+
+// csvNewlines works out the newlines column for text and its
+// translation, which must use the same line endings throughout
+func csvNewlines(texts ...string) (string, error) {
+	crlf, lf := 0, 0
+	for _, text := range texts {
+		crlf += strings.Count(text, "\r\n")
+		lf += strings.Count(text, "\n")
+	}
+	switch {
+	case crlf == 0:
+		return "", nil
+	case crlf == lf:
+		return "crlf", nil
+	}
+	return "", fmt.Errorf("it mixes \\r\\n and \\n line endings, which a spreadsheet can't keep apart")
+}
+
+// placeholders lists each {name} in text, in order of name
+func placeholders(text string) []string {
+	phs := placeholderPattern.FindAllString(text, -1)
+	sort.Strings(phs)
+	return phs
+}
+
+func (csvFormat) Read(s *Store, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	br := bufio.NewReader(f)
+	if r, _, err := br.ReadRune(); err == nil && r != '\uFEFF' {
+		br.UnreadRune()
+	}
+	r := csv.NewReader(br)
+	r.FieldsPerRecord = -1
+
+	header, err := r.Read()
+	if err != nil {
+		return fmt.Errorf("failed to read header of %s: %s", path, err)
+	}
+	columns := map[string]int{}
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, name := range []string{"id", "source"} {
+		if _, ok := columns[name]; !ok {
+			return fmt.Errorf("failed to read %s: no %s column", path, name)
+		}
+	}
+
+	errs := parse.ErrorList{}
+	for n := 2; ; n++ {
+		row, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %s", path, err)
+		}
+		// Errors give the row, as a spreadsheet would number it
+		pos := parse.Position{File: path, Line: n, Col: 1}
+		get := func(name string) string {
+			if i, ok := columns[name]; ok && i < len(row) {
+				return row[i]
+			}
+			return ""
+		}
+
+		id, text, translation := get("id"), get("source"), get("translation")
+		if id == "" {
+			continue
+		}
+		// Translators must keep every variable, and can't add any
+		if translation != "" && strings.Join(placeholders(text), "") != strings.Join(placeholders(translation), "") {
+			errs = append(errs, &parse.ParseError{
+				Position: pos,
+				Msg:      fmt.Sprintf("translation of %s has variables %v, but the source has %v", id, placeholders(translation), placeholders(text)),
+			})
+			continue
+		}
+
+		content := text
+		if translation != "" {
+			content = translation
+		}
+		if get("newlines") == "crlf" {
+			content = strings.ReplaceAll(content, "\n", "\r\n")
+		}
+		msg := s.add(id, content, parse.Position{})
+		if msg == nil {
+			errs = append(errs, &parse.ParseError{Position: pos, Msg: fmt.Sprintf("duplicate message %s", id)})
+			continue
+		}
+		s.addVars(msg, parseVars(get("types")))
+	}
+	return parseErrors(errs, nil)
+}
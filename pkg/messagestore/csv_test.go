@@ -0,0 +1,66 @@
+package messagestore
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/asuffield/ouro-tools/pkg/messagestore/parse"
+)
+
+func TestCSVRoundTrip(t *testing.T) {
+	s := trickyStore(t)
+	sameContent(t, s, writeAndRead(t, s, "out.csv", nil))
+
+	template := sampleStore(t)
+	fr := translatedStore(t)
+	sameContent(t, fr, writeAndRead(t, fr, "fr.csv", template))
+}
+
+// A translation must have the same variables as its source
+func TestCSVPlaceholders(t *testing.T) {
+	for translation, ok := range map[string]bool{
+		"{b} et {a}":  true,
+		"{a}":         false,
+		"{a} {b} {c}": false,
+		"{a} {B}":     false,
+		"":            true,
+	} {
+		dir := makeTree(t, map[string]string{
+			"fr.csv": "id,source,translation\nmsg,{a} and {b},\"" + translation + "\"\n",
+		})
+		s := NewStore()
+		err := s.Read(filepath.Join(dir, "fr.csv"))
+		if ok && err != nil {
+			t.Errorf("%q: %s", translation, err)
+		}
+		if !ok && (err == nil || !strings.Contains(err.Error(), "translation of msg has variables")) {
+			t.Errorf("%q: got %v, want an error about the variables", translation, err)
+		}
+	}
+}
+
+// Spreadsheets turn \r\n into \n, so the endings are recorded, and
+// text which mixes them can't be written
+func TestCSVNewlines(t *testing.T) {
+	s := sampleStore(t)
+	s.add("lf", "one\ntwo", parse.Position{})
+	s.add("cr", "one\rtwo\r", parse.Position{})
+	sameContent(t, s, writeAndRead(t, s, "out.csv", nil))
+
+	s.add("mixed", "one\r\ntwo\nthree", parse.Position{})
+	err := s.Write(filepath.Join(t.TempDir(), "out.csv"), nil)
+	if err == nil || !strings.Contains(err.Error(), "can't write mixed") {
+		t.Errorf("got %v, want an error about mixed", err)
+	}
+
+	// A translation must match its source too
+	fr := translatedStore(t)
+	fr.add("multi2", "line one\nline two", parse.Position{})
+	template := sampleStore(t)
+	template.add("multi2", "line one\r\nline two", parse.Position{})
+	err = fr.Write(filepath.Join(t.TempDir(), "fr.csv"), template)
+	if err == nil || !strings.Contains(err.Error(), "can't write multi2") {
+		t.Errorf("got %v, want an error about multi2", err)
+	}
+}
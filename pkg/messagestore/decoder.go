@@ -0,0 +1,285 @@
+package messagestore
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/asuffield/ouro-tools/pkg/stringtable"
+)
+
+// Limits bound what a binary file is allowed to ask for when it is
+// decoded, so that a corrupt or hostile file fails cleanly instead of
+// exhausting memory. Zero means no limit.
+type Limits struct {
+	MaxStrings    int // Strings in each string table
+	MaxTableBytes int // Bytes in each string table
+	MaxMessages   int
+	MaxIDLength   int
+	MaxVars       int // Variables in each message
+}
+
+// Comfortably larger than any real client file
+var DefaultLimits = Limits{
+	MaxStrings:    1 << 20,
+	MaxTableBytes: 256 << 20,
+	MaxMessages:   1 << 20,
+	MaxIDLength:   4096,
+	MaxVars:       256,
+}
+
+// decoder reads the binary format, keeping track of the offset in the
+// file so that errors can say exactly where the problem is
+type decoder struct {
+	r      io.Reader
+	path   string
+	offset int64
+	limits Limits
+
+	// In salvage mode, keep going past damage and record it, unless
+	// the damage means that nothing after it can be found
+	salvage bool
+	damage  []Damage
+	stopped bool
+
+	// If set, record where everything is
+	layout *Layout
+}
+
+func newDecoder(r io.Reader, path string, limits Limits) *decoder {
+	return &decoder{
+		r:    r,
+		path: path,
+		// The signature has always been read already
+		offset: 4,
+		limits: limits,
+	}
+}
+
+func (d *decoder) Read(p []byte) (int, error) {
+	n, err := d.r.Read(p)
+	d.offset += int64(n)
+	return n, err
+}
+
+func (d *decoder) fail(offset int64, err error, format string, args ...interface{}) error {
+	return decodeError(d.path, offset, err, format, args...)
+}
+
+// Rebase an error from a string table starting at offset
+func (d *decoder) tableError(offset int64, what string, err error) error {
+	var te *stringtable.Error
+	if errors.As(err, &te) {
+		return d.fail(offset+te.Offset, te.Err, "failed to read %s table: %s", what, te.Msg)
+	}
+	return d.fail(offset, err, "failed to read %s table", what)
+}
+
+func (d *decoder) u32(what string) (uint32, error) {
+	offset := d.offset
+	var u uint32
+	if err := binary.Read(d, binary.LittleEndian, &u); err != nil {
+		return 0, d.fail(offset, err, "failed to read %s", what)
+	}
+	return u, nil
+}
+
+func (d *decoder) count(what string, limit int) (uint32, error) {
+	offset := d.offset
+	u, err := d.u32(what)
+	if err != nil {
+		return 0, err
+	}
+	if limit > 0 && uint64(u) > uint64(limit) {
+		return 0, d.fail(offset, ErrLimitExceeded, "%s is %d, limit is %d", what, u, limit)
+	}
+	return u, nil
+}
+
+func (d *decoder) bytes(what string, l uint32) ([]byte, error) {
+	offset := d.offset
+	// Grow the buffer as data arrives, rather than trusting l
+	var buf bytes.Buffer
+	if n, err := io.CopyN(&buf, d, int64(l)); err != nil {
+		return nil, d.fail(offset+n, err, "failed to read %s, got %d of %d bytes", what, n, l)
+	}
+	return buf.Bytes(), nil
+}
+
+func (d *decoder) newTable() *stringtable.Table {
+	t := stringtable.New()
+	t.MaxCount = d.limits.MaxStrings
+	t.MaxBytes = d.limits.MaxTableBytes
+	return t
+}
+
+func (d *decoder) readTable(what string) (*stringtable.Table, error) {
+	offset := d.offset
+	t := d.newTable()
+	if d.stopped {
+		return t, nil
+	}
+	if d.salvage {
+		if err := t.ReadPartial(d); err != nil {
+			err = d.tableError(offset, what, err)
+			if !errors.Is(err, ErrTruncated) {
+				// A header which can't be trusted doesn't say where the
+				// table ends, so reading on would decode the rest of it as
+				// whatever comes next
+				d.stopped = true
+				return t, d.lose(err, "%s table and everything after it", what)
+			}
+			return t, d.lose(err, "%s table after string %d", what, t.Len())
+		}
+		return t, nil
+	}
+	if err := t.Read(d); err != nil {
+		return nil, d.tableError(offset, what, err)
+	}
+	return t, nil
+}
+
+// Like readTable, but for a table held in memory at data
+func (d *decoder) loadTable(what string, data []byte) (*stringtable.Table, int, error) {
+	t := d.newTable()
+	n, err := t.Load(data)
+	if err != nil {
+		return nil, 0, d.tableError(d.offset, what, err)
+	}
+	if d.layout != nil {
+		d.layout.Tables = append(d.layout.Tables, &TableLayout{
+			Name:    what,
+			Offset:  d.offset,
+			Count:   t.Len(),
+			Len:     n,
+			Offsets: t.Offsets(),
+		})
+	}
+	d.offset += int64(n)
+	return t, n, nil
+}
+
+// Damage is something that salvage mode had to give up on
+type Damage struct {
+	Err  error  // What went wrong, and where
+	Lost string // What was lost because of it
+}
+
+func (d Damage) String() string {
+	return fmt.Sprintf("lost %s: %s", d.Lost, d.Err)
+}
+
+// In salvage mode, record the damage and carry on. Otherwise this is
+// just err.
+func (d *decoder) lose(err error, format string, args ...interface{}) error {
+	if !d.salvage {
+		return err
+	}
+	d.damage = append(d.damage, Damage{Err: err, Lost: fmt.Sprintf(format, args...)})
+	return nil
+}
+
+// Record is a message, as it appears in a binary file
+type Record struct {
+	Offset           int64
+	ID               string
+	Index, HelpIndex uint32
+	VarIndices       []uint32
+	// Why the record couldn't be used, if it couldn't
+	Err error
+}
+
+func (d *decoder) readRecord(i uint32) (*Record, error) {
+	rec := &Record{Offset: d.offset}
+
+	l, err := d.count(fmt.Sprintf("length of string %d", i), d.limits.MaxIDLength)
+	if err != nil {
+		return nil, err
+	}
+	data, err := d.bytes(fmt.Sprintf("string %d", i), l)
+	if err != nil {
+		return nil, err
+	}
+	rec.ID = string(data)
+
+	if rec.Index, err = d.u32(fmt.Sprintf("index of %s", rec.ID)); err != nil {
+		return nil, err
+	}
+	if rec.HelpIndex, err = d.u32(fmt.Sprintf("help index of %s", rec.ID)); err != nil {
+		return nil, err
+	}
+
+	varCount, err := d.count(fmt.Sprintf("variable count of %s", rec.ID), d.limits.MaxVars)
+	if err != nil {
+		return nil, err
+	}
+	for j := uint32(0); j < varCount; j++ {
+		index, err := d.u32(fmt.Sprintf("variable index %d of %s", j, rec.ID))
+		if err != nil {
+			return nil, err
+		}
+		rec.VarIndices = append(rec.VarIndices, index)
+	}
+
+	return rec, nil
+}
+
+// Make sure every index in rec can be looked up
+func (d *decoder) check(rec *Record, messageTable, variableTable *stringtable.Table) error {
+	for _, i := range []uint32{rec.Index, rec.HelpIndex} {
+		if uint64(i) >= uint64(messageTable.Len()) {
+			return d.fail(rec.Offset, ErrIndexOutOfRange, "message %s has string index %d, but the messages table has %d strings", rec.ID, i, messageTable.Len())
+		}
+	}
+	for _, i := range rec.VarIndices {
+		// Each variable is a pair of name and type
+		if uint64(i)+1 >= uint64(variableTable.Len()) {
+			return d.fail(rec.Offset, ErrIndexOutOfRange, "message %s has variable index %d, but the variable table has %d strings", rec.ID, i, variableTable.Len())
+		}
+	}
+	return nil
+}
+
+func (d *decoder) readMessages(s *Store, messageTable, variableTable *stringtable.Table) error {
+	if d.stopped {
+		return nil
+	}
+	countOffset := d.offset
+	messageCount, err := d.count("message count", d.limits.MaxMessages)
+	if err != nil {
+		return d.lose(err, "all messages")
+	}
+	if d.layout != nil {
+		d.layout.MessageCountOffset = countOffset
+		d.layout.MessageCount = messageCount
+	}
+
+	for i := uint32(0); i < messageCount; i++ {
+		rec, err := d.readRecord(i)
+		if err != nil {
+			return d.lose(err, "%d of %d messages", messageCount-i, messageCount)
+		}
+		if d.layout != nil {
+			d.layout.Records = append(d.layout.Records, rec)
+		}
+		if err := d.check(rec, messageTable, variableTable); err != nil {
+			rec.Err = err
+			if err := d.lose(err, "message %s", rec.ID); err != nil {
+				return err
+			}
+			continue
+		}
+
+		msg := s.insert(rec.ID)
+		msg.index = int(rec.Index)
+		msg.helpIndex = int(rec.HelpIndex)
+		msg.hasHelp = true
+		for _, index := range rec.VarIndices {
+			msg.varIndices = append(msg.varIndices, int(index))
+		}
+	}
+
+	return nil
+}
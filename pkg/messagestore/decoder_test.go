@@ -0,0 +1,214 @@
+package messagestore
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+// A file with one message, "id", whose text is at index and whose one
+// variable is at varIndex
+func oneMessage(index, varIndex int) []byte {
+	return u32s(BinarySignature,
+		1, 3, "hi\x00",
+		2, 6, "n\x00int\x00",
+		1, 2, "id", index, index, 1, varIndex)
+}
+
+// decodeBoth reads data with both the streaming and the in-memory
+// decoders, which must agree about whether it is an error
+func decodeBoth(t *testing.T, data []byte, limits Limits) (*Store, error) {
+	t.Helper()
+	s := NewStore()
+	s.Limits = limits
+	err := NewDecoder(bytes.NewReader(data)).Decode(s)
+
+	lazy := NewStore()
+	lazy.Limits = limits
+	var lazyErr error
+	if len(data) < 4 {
+		lazyErr = ErrTruncated
+	} else if _, lazyErr = lazy.ReadLayout(data, "input"); lazyErr == nil && err == nil {
+		sameContent(t, s, lazy)
+	}
+	if (err == nil) != (lazyErr == nil) {
+		t.Fatalf("streaming decoder gave %v, in-memory decoder gave %v", err, lazyErr)
+	}
+	return s, err
+}
+
+func TestDecodeHandBuilt(t *testing.T) {
+	s, err := decodeBoth(t, oneMessage(0, 0), DefaultLimits)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := s.Message("id"); got != "hi" {
+		t.Errorf("message is %q, want %q", got, "hi")
+	}
+	if got := s.MessageVarTypes("id"); got["n"] != "int" || len(got) != 1 {
+		t.Errorf("variables are %v, want n int", got)
+	}
+}
+
+func TestDecodeIndexOutOfRange(t *testing.T) {
+	for _, data := range [][]byte{oneMessage(1, 0), oneMessage(0, 1), oneMessage(-1, 0)} {
+		_, err := decodeBoth(t, data, DefaultLimits)
+		if !errors.Is(err, ErrIndexOutOfRange) {
+			t.Errorf("got %v, want %v", err, ErrIndexOutOfRange)
+		}
+		var de *DecodeError
+		if !errors.As(err, &de) || de.Offset != 33 {
+			t.Errorf("got %v, want a DecodeError at the record, offset 33", err)
+		}
+	}
+}
+
+func TestDecodeLimits(t *testing.T) {
+	data := encode(t, sampleStore(t))
+	for name, limits := range map[string]Limits{
+		"strings":     {MaxStrings: 2},
+		"table bytes": {MaxTableBytes: 10},
+		"messages":    {MaxMessages: 2},
+		"id length":   {MaxIDLength: 3},
+		"vars":        {MaxVars: 1},
+	} {
+		if _, err := decodeBoth(t, data, limits); !errors.Is(err, ErrLimitExceeded) {
+			t.Errorf("%s: got %v, want %v", name, err, ErrLimitExceeded)
+		}
+	}
+}
+
+func TestDecodeTruncated(t *testing.T) {
+	data := encode(t, sampleStore(t))
+	for n := 0; n < len(data); n++ {
+		_, err := decodeBoth(t, data[:n], DefaultLimits)
+		if !errors.Is(err, ErrTruncated) {
+			t.Fatalf("cut to %d bytes: got %v, want %v", n, err, ErrTruncated)
+		}
+	}
+}
+
+// Huge lengths must fail without trying to allocate them
+func TestDecodeHugeLengths(t *testing.T) {
+	huge := 0xffffffff
+	for _, data := range [][]byte{
+		u32s(BinarySignature, huge, huge),
+		u32s(BinarySignature, 1, huge, "x\x00"),
+		u32s(BinarySignature, 0, 0, 0, 0, huge),
+		u32s(BinarySignature, 0, 0, 0, 0, 1, huge, "id"),
+		u32s(BinarySignature, 0, 0, 0, 0, 1, 2, "id", 0, 0, huge),
+	} {
+		if _, err := decodeBoth(t, data, Limits{}); err == nil {
+			t.Errorf("no error from %x", data)
+		}
+	}
+}
+
+// The decoder must never panic, and whatever it accepts must be usable
+func FuzzDecode(f *testing.F) {
+	f.Add(oneMessage(0, 0))
+	f.Add(oneMessage(1, 0))
+	f.Add(oneMessage(0, 1))
+	f.Add(u32s(BinarySignature, 0xffffffff, 0xffffffff))
+	f.Add(u32s(BinarySignature, 3, 1, "\x00"))
+	f.Add(u32s(BinarySignature, 0, 0, 0, 0, 1, 2, "id", 0, 0, 0xffffffff))
+	f.Add([]byte{})
+	f.Fuzz(func(t *testing.T, data []byte) {
+		s, err := decodeBoth(t, data, DefaultLimits)
+		if err != nil {
+			return
+		}
+		for _, id := range s.MessageIDs() {
+			s.Message(id)
+			s.MessageVars(id)
+		}
+	})
+}
+
+func TestSalvage(t *testing.T) {
+	orig := sampleStore(t)
+	data := encode(t, orig)
+	layout, err := NewStore().ReadLayout(data, "input")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for n := 4; n <= len(data); n++ {
+		s := NewStore()
+		s.Salvage = true
+		if err := NewDecoder(bytes.NewReader(data[:n])).Decode(s); err != nil {
+			t.Fatalf("cut to %d bytes: %s", n, err)
+		}
+		if n < len(data) && len(s.Damage()) == 0 {
+			t.Errorf("cut to %d bytes: no damage reported", n)
+		}
+
+		// Every record which is all there is kept, exactly as it was
+		want := 0
+		for i := range layout.Records {
+			end := int64(len(data))
+			if i+1 < len(layout.Records) {
+				end = layout.Records[i+1].Offset
+			}
+			if end <= int64(n) {
+				want++
+			}
+		}
+		if got := len(s.MessageIDs()); got != want {
+			t.Errorf("cut to %d bytes: salvaged %d messages, want %d", n, got, want)
+		}
+		for _, id := range s.MessageIDs() {
+			if s.Message(id) != orig.Message(id) || formatVars(s.MessageVars(id)) != formatVars(orig.MessageVars(id)) {
+				t.Errorf("cut to %d bytes: %s is %q %s, want %q %s", n, id,
+					s.Message(id), formatVars(s.MessageVars(id)), orig.Message(id), formatVars(orig.MessageVars(id)))
+			}
+		}
+	}
+}
+
+func TestSalvageBadRecord(t *testing.T) {
+	data := u32s(BinarySignature,
+		1, 3, "hi\x00",
+		0, 0,
+		3,
+		1, "a", 0, 0, 0,
+		1, "b", 5, 0, 0,
+		1, "c", 0, 0, 0)
+	s := NewStore()
+	s.Salvage = true
+	if err := NewDecoder(bytes.NewReader(data)).Decode(s); err != nil {
+		t.Fatal(err)
+	}
+	if !s.HasMessage("a") || s.HasMessage("b") || !s.HasMessage("c") {
+		t.Errorf("salvaged %v, want a and c", s.MessageIDs())
+	}
+	if d := s.Damage(); len(d) != 1 || !errors.Is(d[0].Err, ErrIndexOutOfRange) {
+		t.Errorf("damage is %v, want one index out of range", d)
+	}
+}
+
+// After a table header which can't be trusted, salvage gives up rather
+// than decoding the table as whatever comes after it
+func TestSalvageBadTableHeader(t *testing.T) {
+	for name, data := range map[string][]byte{
+		"limit": u32s(BinarySignature,
+			200, 20, "hi\x00",
+			0, 0, 1, 1, "a", 0, 0, 0),
+		"malformed": u32s(BinarySignature,
+			30, 20, "hi\x00",
+			0, 0, 1, 1, "a", 0, 0, 0),
+	} {
+		s := NewStore()
+		s.Salvage = true
+		s.Limits.MaxStrings = 100
+		if err := NewDecoder(bytes.NewReader(data)).Decode(s); err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+		if ids := s.MessageIDs(); len(ids) != 0 {
+			t.Errorf("%s: salvaged %v", name, ids)
+		}
+		if d := s.Damage(); len(d) != 1 || d[0].Lost != "messages table and everything after it" {
+			t.Errorf("%s: damage is %v, want just the messages table and everything after it", name, d)
+		}
+	}
+}
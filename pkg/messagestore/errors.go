@@ -0,0 +1,47 @@
+package messagestore
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/asuffield/ouro-tools/pkg/stringtable"
+)
+
+// Reasons a binary file can fail to decode, for use with errors.Is
+var (
+	ErrBadSignature    = errors.New("bad signature")
+	ErrTruncated       = stringtable.ErrTruncated
+	ErrLimitExceeded   = stringtable.ErrLimitExceeded
+	ErrMalformed       = stringtable.ErrMalformed
+	ErrIndexOutOfRange = errors.New("index out of range")
+)
+
+// DecodeError is a problem with a binary file. Offset is from the start
+// of the file, and Err is one of the errors above or an I/O error.
+type DecodeError struct {
+	Path   string
+	Offset int64
+	Msg    string
+	Err    error
+}
+
+func (e *DecodeError) Error() string {
+	return fmt.Sprintf("%s at offset %d in %s: %s", e.Msg, e.Offset, e.Path, e.Err)
+}
+
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+func decodeError(path string, offset int64, err error, format string, args ...interface{}) error {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		err = ErrTruncated
+	}
+	return &DecodeError{
+		Path:   path,
+		Offset: offset,
+		Msg:    fmt.Sprintf(format, args...),
+		Err:    err,
+	}
+}
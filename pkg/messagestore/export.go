@@ -0,0 +1,117 @@
+package messagestore
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/asuffield/ouro-tools/pkg/messagestore/parse"
+	"github.com/asuffield/ouro-tools/pkg/staging"
+)
+
+// Export is what a user supplied text/template is run over, for one-off
+// outputs which aren't worth a format of their own
+type Export struct {
+	// Sorted by id
+	Messages []*ExportMessage
+	// Messages which share type entries, see typePrefixes. Sorted by base.
+	Families []*ExportFamily
+}
+
+type ExportMessage struct {
+	ID      string
+	Text    string
+	Help    string
+	HasHelp bool
+	Vars    []parse.Var
+	// The id of the type entry for the message's family
+	Family string
+	// Where the message was defined, if it came from a text file, and
+	// the comments just before it
+	File     string
+	Line     int
+	Comments []string
+}
+
+type ExportFamily struct {
+	Base     string
+	Messages []*ExportMessage
+}
+
+// Export collects everything in the store for a template
+func (s *Store) Export() *Export {
+	ids := s.MessageIDs()
+	sort.Strings(ids)
+	comments := s.comments()
+
+	e := &Export{}
+	families := map[string]*ExportFamily{}
+	for _, id := range ids {
+		m := &ExportMessage{ID: id, Text: s.Message(id), Vars: s.MessageVars(id), Family: typeBase(id)}
+		m.Help, m.HasHelp = s.MessageHelp(id)
+		if pos, ok := s.MessageDefinition(id); ok {
+			m.File = pos.File
+			m.Line = pos.Line
+		}
+		for _, c := range comments[strings.ToLower(id)] {
+			m.Comments = append(m.Comments, commentText(c))
+		}
+		e.Messages = append(e.Messages, m)
+
+		key := strings.ToLower(m.Family)
+		f, ok := families[key]
+		if !ok {
+			f = &ExportFamily{Base: m.Family}
+			families[key] = f
+			e.Families = append(e.Families, f)
+		}
+		f.Messages = append(f.Messages, m)
+	}
+	sort.Slice(e.Families, func(i, j int) bool {
+		return e.Families[i].Base < e.Families[j].Base
+	})
+	return e
+}
+
+// Functions available to templates, on top of the text/template builtins
+var exportFuncs = template.FuncMap{
+	"json": func(v interface{}) (string, error) {
+		data, err := json.Marshal(v)
+		return string(data), err
+	},
+	"quote":      func(s string) string { return fmt.Sprintf("%q", s) },
+	"lower":      strings.ToLower,
+	"upper":      strings.ToUpper,
+	"join":       strings.Join,
+	"replace":    func(s, old, new string) string { return strings.ReplaceAll(s, old, new) },
+	"lines":      func(s string) []string { return strings.Split(strings.ReplaceAll(s, "\r\n", "\n"), "\n") },
+	"formatVars": formatVars,
+}
+
+// PlanTemplate works out the output of running the text/template in
+// tmplPath over Export, without writing anything
+func (s *Store) PlanTemplate(path, tmplPath string) (*staging.Plan, error) {
+	data, err := s.ExecuteTemplate(tmplPath)
+	if err != nil {
+		return nil, err
+	}
+	p := staging.NewPlan()
+	return p, p.Add(path, data, len(s.messages))
+}
+
+// ExecuteTemplate runs the text/template in tmplPath over Export
+func (s *Store) ExecuteTemplate(tmplPath string) ([]byte, error) {
+	t, err := template.New(filepath.Base(tmplPath)).Funcs(exportFuncs).ParseFiles(tmplPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read template %s: %s", tmplPath, err)
+	}
+	var b bytes.Buffer
+	if err := t.Execute(&b, s.Export()); err != nil {
+		return nil, fmt.Errorf("failed to run template %s: %s", tmplPath, err)
+	}
+	return b.Bytes(), nil
+}
@@ -0,0 +1,87 @@
+package messagestore
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeTemplate(t *testing.T, text string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "out.tmpl")
+	if err := os.WriteFile(path, []byte(text), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+const exportTemplate = `{{range .Families}}{{.Base}}:{{range .Messages}} {{.ID}}{{end}}
+{{end}}{{range .Messages}}{{if .Comments}}{{join .Comments ","}} {{end}}{{.ID}} {{.Line}} {{quote .Text}} {{formatVars .Vars}}
+{{end}}`
+
+func TestExecuteTemplate(t *testing.T) {
+	s := sampleStore(t)
+	data, err := s.ExecuteTemplate(writeTemplate(t, exportTemplate))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "bye: bye\n" +
+		"count: count\n" +
+		"hello: hello v_hello\n" +
+		"multi: multi\n" +
+		"bye 1 \"Bye\" \n" +
+		"count 7 \"{n} of {total}\" {n,int} {total,int}\n" +
+		"Greetings hello 2 \"Hello {name}!\" {name,string}\n" +
+		"multi 5 \"line one\\r\\nline two\" \n" +
+		"v_hello 3 \"Hi \\\"there\\\" {name}\" {name,string}\n"
+	if string(data) != want {
+		t.Errorf("got\n%s\nwant\n%s", data, want)
+	}
+
+	for _, m := range s.Export().Messages {
+		want := "main.txt"
+		if m.ID == "bye" {
+			want = "sub.txt"
+		}
+		if filepath.Base(m.File) != want {
+			t.Errorf("%s is from %s, want %s", m.ID, m.File, want)
+		}
+	}
+
+	// Planned, it's written to the file it's given, like any other output
+	path := filepath.Join(t.TempDir(), "out.txt")
+	p, err := s.PlanTemplate(path, writeTemplate(t, exportTemplate))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := os.ReadFile(path); err != nil || string(got) != want {
+		t.Errorf("wrote %q, %v", got, err)
+	}
+}
+
+// Templates which don't parse, or fail when run, say which template it
+// was and don't write anything
+func TestExecuteTemplateErrors(t *testing.T) {
+	s := sampleStore(t)
+	for name, text := range map[string]string{
+		"parse": "{{range .Messages}}",
+		"run":   "{{.NoSuchField}}",
+		"func":  `{{join .Messages ","}}`,
+	} {
+		tmpl := writeTemplate(t, text)
+		if _, err := s.ExecuteTemplate(tmpl); err == nil || !strings.Contains(err.Error(), tmpl) {
+			t.Errorf("%s: got %v", name, err)
+		}
+		path := filepath.Join(t.TempDir(), "out.txt")
+		if _, err := s.PlanTemplate(path, tmpl); err == nil {
+			t.Errorf("%s: planned anyway", name)
+		}
+	}
+	if _, err := s.ExecuteTemplate(filepath.Join(t.TempDir(), "missing.tmpl")); err == nil {
+		t.Errorf("no error for a missing template")
+	}
+}
@@ -0,0 +1,151 @@
+package messagestore
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/asuffield/ouro-tools/pkg/staging"
+)
+
+// Format is a file format which a store can be read from and written to
+type Format interface {
+	Name() string
+	// Detect is whether path is in this format. head is the start of the
+	// file, or nil when it is about to be written and doesn't exist yet.
+	Detect(path string, head []byte) bool
+	Read(s *Store, path string) error
+	// Write adds whatever files are needed for s to p. template is nil
+	// if there isn't one.
+	Write(p *staging.Plan, s *Store, path string, template *Store) error
+}
+
+var formats = []Format{binaryFormat{}}
+
+// textFormat is for anything which isn't detected as something else
+var textFormat Format = textFormatType{}
+
+// RegisterFormat adds a format to those which Read and Write detect
+func RegisterFormat(f Format) {
+	formats = append(formats, f)
+}
+
+// DetectFormat works out what format an existing file or directory is in
+func DetectFormat(path string) (Format, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return textFormat, nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	head := make([]byte, 512)
+	n, err := io.ReadFull(f, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return nil, fmt.Errorf("failed to read %s: %s", path, err)
+	}
+
+	for _, format := range formats {
+		if format.Detect(path, head[:n]) {
+			return format, nil
+		}
+	}
+	return textFormat, nil
+}
+
+// OutputFormat works out what format to write path in. Without anything
+// in the name to go on, it's the format of the template.
+func OutputFormat(path string, template *Store) Format {
+	for _, format := range formats {
+		if format.Detect(path, nil) {
+			return format
+		}
+	}
+	if template != nil && template.format != nil {
+		return template.format
+	}
+	return textFormat
+}
+
+type binaryFormat struct{}
+
+func (binaryFormat) Name() string {
+	return "binary"
+}
+
+// Anything claiming to be binary is, so that a bad signature is reported
+func (binaryFormat) Detect(path string, head []byte) bool {
+	if len(head) >= 4 && binary.LittleEndian.Uint32(head) == BinarySignature {
+		return true
+	}
+	return strings.HasSuffix(path, ".bin")
+}
+
+func (binaryFormat) Read(s *Store, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if s.Lazy {
+		var signature uint32
+		if err := binary.Read(f, binary.LittleEndian, &signature); err == nil && signature == BinarySignature {
+			return s.readBinMapped(f, path)
+		}
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			return fmt.Errorf("failed to read %s: %s", path, err)
+		}
+	}
+
+	d := NewDecoder(f)
+	d.Name = path
+	return d.Decode(s)
+}
+
+func (binaryFormat) Write(p *staging.Plan, s *Store, path string, template *Store) error {
+	return s.planBin(p, path)
+}
+
+type textFormatType struct{}
+
+func (textFormatType) Name() string {
+	return "text"
+}
+
+func (textFormatType) Detect(path string, head []byte) bool {
+	return true
+}
+
+func (textFormatType) Read(s *Store, path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		return s.ReadDir(path)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return s.ReadText(f, path)
+}
+
+// A template in some other format has no files to follow
+func (textFormatType) Write(p *staging.Plan, s *Store, path string, template *Store) error {
+	if template != nil && template.format != textFormat {
+		template = nil
+	}
+	return s.planText(p, path, template)
+}
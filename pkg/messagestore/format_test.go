@@ -0,0 +1,75 @@
+package messagestore
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Every format is found from the name, and binary and XLIFF from the
+// content too
+func TestDetectFormat(t *testing.T) {
+	dir := t.TempDir()
+	bin := encode(t, sampleStore(t))
+	xliff := []byte("<?xml version=\"1.0\"?>\n<xliff xmlns=\"" + xliffNamespace + "\" version=\"2.0\"></xliff>\n")
+	for name, tc := range map[string]struct {
+		data []byte
+		want string
+	}{
+		"a.bin":     {bin, "binary"},
+		"unnamed":   {bin, "binary"},
+		"bad.bin":   {[]byte("not really"), "binary"},
+		"a.po":      {[]byte("msgid \"\"\nmsgstr \"\"\n"), "po"},
+		"a.pot":     {[]byte("msgid \"\"\nmsgstr \"\"\n"), "pot"},
+		"a.xlf":     {xliff, "xliff"},
+		"a.xliff":   {xliff, "xliff"},
+		"xliff.xml": {xliff, "xliff"},
+		"a.csv":     {[]byte("id,text\n"), "csv"},
+		"a.json":    {[]byte("{}"), "json"},
+		"a.yaml":    {[]byte("{}"), "yaml"},
+		"a.yml":     {[]byte("{}"), "yaml"},
+		"a.txt":     {[]byte("\"a\" \"A\"\n"), "text"},
+		"short":     {[]byte("\"a"), "text"},
+		"empty":     {nil, "text"},
+	} {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, tc.data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		f, err := DetectFormat(path)
+		if err != nil {
+			t.Errorf("%s: %s", name, err)
+		} else if f.Name() != tc.want {
+			t.Errorf("%s is %s, want %s", name, f.Name(), tc.want)
+		}
+	}
+
+	if f, err := DetectFormat(dir); err != nil || f.Name() != "text" {
+		t.Errorf("directory is %v, %v", f, err)
+	}
+	if _, err := DetectFormat(filepath.Join(dir, "missing")); !os.IsNotExist(err) {
+		t.Errorf("got %v for a missing file", err)
+	}
+}
+
+// Output goes by the name, and then the format of the template
+func TestOutputFormat(t *testing.T) {
+	xliffTemplate := NewStore()
+	xliffTemplate.format = xliffFormat{}
+	for _, tc := range []struct {
+		path     string
+		template *Store
+		want     string
+	}{
+		{"out.bin", nil, "binary"},
+		{"out.po", xliffTemplate, "po"},
+		{"out.yml", nil, "yaml"},
+		{"out", nil, "text"},
+		{"out", xliffTemplate, "xliff"},
+		{"out", sampleStore(t), "text"},
+	} {
+		if got := OutputFormat(tc.path, tc.template).Name(); got != tc.want {
+			t.Errorf("%s is %s, want %s", tc.path, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package messagestore
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/asuffield/ouro-tools/pkg/messagestore/parse"
+)
+
+// makeTree writes files into a temporary directory, and returns it
+func makeTree(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+// readStore reads path, which must have no errors
+func readStore(t *testing.T, path string) *Store {
+	t.Helper()
+	s := NewStore()
+	s.BaseDir = filepath.Dir(path)
+	if err := s.Read(path); err != nil {
+		t.Fatalf("failed to read %s: %s", path, err)
+	}
+	return s
+}
+
+// A small tree with a bit of everything: quoting, multiline messages,
+// comments and a family of messages sharing types
+var sampleTree = map[string]string{
+	"main.txt": "\uFEFF// Greetings\r\n" +
+		"\"hello\" \"Hello {name}!\"\r\n" +
+		"\"v_hello\" \"Hi \\\"there\\\" {name}\"\r\n" +
+		"\r\n" +
+		"\"multi\" <<line one\r\nline two>>\r\n" +
+		"\"count\" \"{n} of {total}\"\r\n" +
+		"import sub.txt types.txt\r\n",
+	"sub.txt": "\uFEFF\"bye\" \"Bye\"\r\n",
+	"types.txt": "\"hello\" {name,string}\r\n" +
+		"\"count\" {n,int} {total,int}\r\n",
+}
+
+func sampleStore(t *testing.T) *Store {
+	t.Helper()
+	return readStore(t, filepath.Join(makeTree(t, sampleTree), "main.txt"))
+}
+
+func encode(t *testing.T, s *Store) []byte {
+	t.Helper()
+	var b bytes.Buffer
+	if err := NewEncoder(&b).Encode(s); err != nil {
+		t.Fatal(err)
+	}
+	return b.Bytes()
+}
+
+// u32s builds binary data by hand, for files the encoder won't write
+func u32s(values ...interface{}) []byte {
+	var b bytes.Buffer
+	for _, v := range values {
+		switch v := v.(type) {
+		case int:
+			binary.Write(&b, binary.LittleEndian, uint32(v))
+		case string:
+			b.WriteString(v)
+		}
+	}
+	return b.Bytes()
+}
+
+// sameContent fails unless a and b have the same messages and types
+func sameContent(t *testing.T, a, b *Store) {
+	t.Helper()
+	for _, c := range a.Changes(b) {
+		t.Errorf("%s", c)
+	}
+	if a.ContentHash() != b.ContentHash() {
+		t.Errorf("content hash changed from %s to %s", a.ContentHash(), b.ContentHash())
+	}
+}
+
+// trickyStore is sampleStore with a message using everything the other
+// formats have to escape
+func trickyStore(t *testing.T) *Store {
+	t.Helper()
+	s := sampleStore(t)
+	msg := s.add("tricky", "a\tb \\ \"q\" <x> & 'y' {name} {other}\r\nlast\r\n", parse.Position{})
+	s.addVars(msg, []parse.Var{{Name: "name", Ty: "string"}})
+	return s
+}
+
+// writeAndRead writes s to name in a temporary directory, in the format
+// that the name gives, and reads it back
+func writeAndRead(t *testing.T, s *Store, name string, template *Store) *Store {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := s.Write(path, template); err != nil {
+		t.Fatalf("failed to write %s: %s", name, err)
+	}
+	return readStore(t, path)
+}
+
+// translatedStore is sampleStore with hello translated
+func translatedStore(t *testing.T) *Store {
+	t.Helper()
+	tree := map[string]string{}
+	for name, content := range sampleTree {
+		tree[name] = strings.Replace(content, "Hello {name}!", "Bonjour {name}!", 1)
+	}
+	return readStore(t, filepath.Join(makeTree(t, tree), "main.txt"))
+}
@@ -0,0 +1,134 @@
+package messagestore
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Layout records where everything is in a binary file
+type Layout struct {
+	Size               int64
+	Signature          uint32
+	Tables             []*TableLayout
+	MessageCountOffset int64
+	MessageCount       uint32
+	Records            []*Record
+}
+
+type TableLayout struct {
+	Name   string
+	Offset int64
+	Count  int
+	// Length of the whole table, including the header
+	Len int
+	// Where each string starts, from the start of the table
+	Offsets []int
+}
+
+// ReadLayout reads the binary file in data, including the signature,
+// into the store and records where everything was. When there is an
+// error, the layout covers everything up to the problem.
+func (s *Store) ReadLayout(data []byte, path string) (*Layout, error) {
+	layout := &Layout{Size: int64(len(data))}
+	if len(data) < 4 {
+		return layout, decodeError(path, 0, ErrTruncated, "failed to read signature")
+	}
+	layout.Signature = binary.LittleEndian.Uint32(data)
+	if layout.Signature != BinarySignature {
+		return layout, decodeError(path, 0, ErrBadSignature, "signature is %d, expected %d", layout.Signature, BinarySignature)
+	}
+
+	d := newDecoder(nil, path, s.Limits)
+	d.layout = layout
+	return layout, s.readBinBytes(d, data[4:])
+}
+
+// Dump writes an annotated hex view of data, which must be the file
+// that the layout came from
+func (l *Layout) Dump(w io.Writer, data []byte) {
+	pos := int64(0)
+	field := func(offset int64, length int, format string, args ...interface{}) {
+		end := offset + int64(length)
+		if end > int64(len(data)) {
+			end = int64(len(data))
+		}
+		dumpBytes(w, offset, data[offset:end], fmt.Sprintf(format, args...))
+		pos = end
+	}
+	u32 := func(offset int64, format string, args ...interface{}) {
+		field(offset, 4, format, args...)
+	}
+
+	if l.Size < 4 {
+		field(0, len(data), "undecoded")
+		return
+	}
+	u32(0, "signature %d", l.Signature)
+
+	for _, t := range l.Tables {
+		u32(t.Offset, "%s table: %d strings", t.Name, t.Count)
+		u32(t.Offset+4, "%s table: %d bytes", t.Name, t.Len-8)
+		for i, start := range t.Offsets {
+			end := t.Len
+			if i+1 < len(t.Offsets) {
+				end = t.Offsets[i+1]
+			} else if n := bytes.IndexByte(data[t.Offset+int64(start):t.Offset+int64(end)], 0); n >= 0 {
+				end = start + n + 1
+			}
+			s := string(data[t.Offset+int64(start) : t.Offset+int64(end)])
+			field(t.Offset+int64(start), end-start, "%s string %d: %q", t.Name, i, strings.TrimSuffix(s, "\x00"))
+		}
+		if pos < t.Offset+int64(t.Len) {
+			field(pos, int(t.Offset+int64(t.Len)-pos), "%s table: unused", t.Name)
+		}
+	}
+
+	if len(l.Tables) == 2 && l.MessageCountOffset != 0 {
+		u32(l.MessageCountOffset, "message count %d", l.MessageCount)
+	}
+
+	for i, r := range l.Records {
+		u32(r.Offset, "message %d: id length %d", i, len(r.ID))
+		field(r.Offset+4, len(r.ID), "message %d: id %q", i, r.ID)
+		offset := r.Offset + 4 + int64(len(r.ID))
+		u32(offset, "message %d: index %d", i, r.Index)
+		u32(offset+4, "message %d: help index %d", i, r.HelpIndex)
+		u32(offset+8, "message %d: %d variables", i, len(r.VarIndices))
+		for j, index := range r.VarIndices {
+			u32(offset+12+int64(j)*4, "message %d: variable %d index %d", i, j, index)
+		}
+		if r.Err != nil {
+			fmt.Fprintf(w, "%-57s  message %d is invalid: %s\n", "", i, r.Err)
+		}
+	}
+
+	if pos < int64(len(data)) {
+		field(pos, int(int64(len(data))-pos), "undecoded")
+	}
+}
+
+// Write data as hex, sixteen bytes to a line, with the description on
+// the first line
+func dumpBytes(w io.Writer, offset int64, data []byte, desc string) {
+	for {
+		n := len(data)
+		if n > 16 {
+			n = 16
+		}
+		hex := []string{}
+		for _, b := range data[:n] {
+			hex = append(hex, fmt.Sprintf("%02x", b))
+		}
+		fmt.Fprintf(w, "%08x  %-47s  %s\n", offset, strings.Join(hex, " "), desc)
+
+		data = data[n:]
+		offset += int64(n)
+		desc = ""
+		if len(data) == 0 {
+			return
+		}
+	}
+}
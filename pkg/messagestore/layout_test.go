@@ -0,0 +1,52 @@
+package messagestore
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestLayoutDump(t *testing.T) {
+	data := encode(t, sampleStore(t))
+	l, err := NewStore().ReadLayout(data, "input")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var b strings.Builder
+	l.Dump(&b, data)
+	for _, want := range []string{
+		"signature 20090521",
+		"messages table: 5 strings",
+		`message 0: id "bye"`,
+		"message 1: variable 1 index 4",
+	} {
+		if !strings.Contains(b.String(), want) {
+			t.Errorf("dump has no %q:\n%s", want, b.String())
+		}
+	}
+	if strings.Contains(b.String(), "undecoded") {
+		t.Errorf("dump has undecoded bytes:\n%s", b.String())
+	}
+}
+
+// A record which fails validation is still shown, with the reason
+func TestLayoutInvalidRecord(t *testing.T) {
+	data := oneMessage(1, 0)
+	l, err := NewStore().ReadLayout(data, "input")
+	if !errors.Is(err, ErrIndexOutOfRange) {
+		t.Fatalf("got %v, want %v", err, ErrIndexOutOfRange)
+	}
+	if len(l.Records) != 1 || !errors.Is(l.Records[0].Err, ErrIndexOutOfRange) {
+		t.Fatalf("records are %v, want the invalid one", l.Records)
+	}
+	var b strings.Builder
+	l.Dump(&b, data)
+	for _, want := range []string{`message 0: id "id"`, "message 0: index 1", "message 0 is invalid: message id has string index 1"} {
+		if !strings.Contains(b.String(), want) {
+			t.Errorf("dump has no %q:\n%s", want, b.String())
+		}
+	}
+	if strings.Contains(b.String(), "undecoded") {
+		t.Errorf("dump has undecoded bytes:\n%s", b.String())
+	}
+}
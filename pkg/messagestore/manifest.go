@@ -0,0 +1,274 @@
+package messagestore
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/asuffield/ouro-tools/pkg/messagestore/parse"
+	"github.com/asuffield/ouro-tools/pkg/staging"
+)
+
+// Manifest records how a text tree was laid out, so that it can be
+// rebuilt from a binary file which only has the messages
+type Manifest struct {
+	Files []*ManifestFile `json:"files"`
+}
+
+type ManifestFile struct {
+	// Relative to the directory of the root file, and can't be outside it
+	Path     string          `json:"path"`
+	TypeFile bool            `json:"type_file,omitempty"`
+	BOM      bool            `json:"bom,omitempty"`
+	Lines    []*ManifestLine `json:"lines"`
+}
+
+// ManifestLine is one line of a file. Kind is one of import, blank,
+// comment, message, type or bad, for a line which couldn't be parsed.
+// The content of messages and the types of variables come from the
+// store. EOL is how the line ends, one of lf, cr or none, and \r\n if
+// it isn't given.
+type ManifestLine struct {
+	Kind        string         `json:"kind"`
+	EOL         string         `json:"eol,omitempty"`
+	ID          string         `json:"id,omitempty"`
+	Multiline   bool           `json:"multiline,omitempty"`
+	Vars        []*ManifestVar `json:"vars,omitempty"`
+	Text        string         `json:"text,omitempty"`
+	MessageFile string         `json:"message_file,omitempty"`
+	TypeFile    string         `json:"type_file,omitempty"`
+	// What else is on a message line, see parse.MessageEntry. Gap is a
+	// space if it isn't given.
+	Gap  *string `json:"gap,omitempty"`
+	Junk string  `json:"junk,omitempty"`
+}
+
+// ManifestVar is a variable in a type entry, with its padding, see
+// parse.VarType. Lead is a space if it isn't given.
+type ManifestVar struct {
+	Name    string  `json:"name"`
+	Lead    *string `json:"lead,omitempty"`
+	NamePad string  `json:"name_pad,omitempty"`
+	TypePad string  `json:"type_pad,omitempty"`
+}
+
+// unlessSpace is nil for a single space, which is the default for
+// padding in manifests
+func unlessSpace(s string) *string {
+	if s == " " {
+		return nil
+	}
+	return &s
+}
+
+func orSpace(s *string) string {
+	if s == nil {
+		return " "
+	}
+	return *s
+}
+
+// checkManifestPath makes sure that path stays inside the directory
+// that the tree is written to
+func checkManifestPath(path string) error {
+	if filepath.IsAbs(path) || path == ".." || strings.HasPrefix(filepath.Clean(path), ".."+string(filepath.Separator)) {
+		return fmt.Errorf("%s is outside the directory of the root file, which manifests can't describe", path)
+	}
+	return nil
+}
+
+// Manifest describes the text files read into the store. Their paths
+// are relative to BaseDir, which must be the directory of the root file.
+func (s *Store) Manifest() (*Manifest, error) {
+	names := []string{}
+	for name := range s.inputFiles {
+		if err := checkManifestPath(name); err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	m := &Manifest{}
+	for _, name := range names {
+		file := s.inputFiles[name]
+		mf := &ManifestFile{Path: name, TypeFile: file.TypeFile, BOM: file.BOM}
+		file.Walk(func(line parse.Line) {
+			var ml *ManifestLine
+			switch l := line.(type) {
+			case *parse.Import:
+				ml = &ManifestLine{Kind: "import", MessageFile: l.MessageFile, TypeFile: l.TypeFile}
+			case *parse.Blank:
+				ml = &ManifestLine{Kind: "blank"}
+			case *parse.Comment:
+				ml = &ManifestLine{Kind: "comment", Text: l.Text()}
+			case *parse.MessageEntry:
+				ml = &ManifestLine{Kind: "message", ID: l.ID(), Multiline: l.Multiline(), Gap: unlessSpace(l.Gap()), Junk: l.Junk()}
+			case *parse.TypeEntry:
+				vars := []*ManifestVar{}
+				for _, v := range l.Vars() {
+					lead, namePad, typePad := v.Padding()
+					vars = append(vars, &ManifestVar{Name: v.Name(), Lead: unlessSpace(lead), NamePad: namePad, TypePad: typePad})
+				}
+				ml = &ManifestLine{Kind: "type", ID: l.ID(), Vars: vars, Junk: l.Junk()}
+			case *parse.BadLine:
+				ml = &ManifestLine{Kind: "bad", Text: l.Text()}
+			default:
+				return
+			}
+			if eol, ok := line.(interface{ LineEnd() string }); ok {
+				ml.EOL = eolNames[eol.LineEnd()]
+			}
+			mf.Lines = append(mf.Lines, ml)
+		})
+		m.Files = append(m.Files, mf)
+	}
+	return m, nil
+}
+
+// How line endings are written in manifests, other than \r\n
+var eolNames = map[string]string{"\n": "lf", "\r": "cr", "": "none"}
+
+func (s *Store) WriteManifest(path string) error {
+	p := staging.NewPlan()
+	if err := s.PlanManifest(p, path); err != nil {
+		return err
+	}
+	return p.Commit()
+}
+
+// PlanManifest adds the manifest for the tree to p
+func (s *Store) PlanManifest(p *staging.Plan, path string) error {
+	m, err := s.Manifest()
+	if err != nil {
+		return fmt.Errorf("can't write manifest %s: %s", path, err)
+	}
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode manifest: %s", err)
+	}
+	return p.Add(path, append(data, '\n'), 0)
+}
+
+func ReadManifest(path string) (*Manifest, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %s", path, err)
+	}
+	m := &Manifest{}
+	if err := json.Unmarshal(data, m); err != nil {
+		return nil, fmt.Errorf("failed to decode manifest %s: %s", path, err)
+	}
+	return m, nil
+}
+
+func (f *ManifestFile) build() (*parse.MessageFile, error) {
+	file := parse.NewMessageFile(f.TypeFile)
+	file.BOM = f.BOM
+	for _, l := range f.Lines {
+		var line interface {
+			parse.Line
+			SetLineEnd(string)
+		}
+		switch l.Kind {
+		case "import":
+			line = parse.NewImport(l.MessageFile, l.TypeFile)
+		case "blank":
+			line = parse.NewBlank()
+		case "comment":
+			line = parse.NewComment(l.Text)
+		case "message":
+			// The content is filled in when the file is written
+			m, _ := parse.NewMessageEntry(l.ID, "", l.Multiline)
+			m.SetGap(orSpace(l.Gap))
+			m.SetJunk(l.Junk)
+			line = m
+		case "type":
+			vars := []*parse.VarType{}
+			for _, v := range l.Vars {
+				vt := parse.NewVarType(v.Name, "")
+				vt.SetPadding(orSpace(v.Lead), v.NamePad, v.TypePad)
+				vars = append(vars, vt)
+			}
+			t := parse.NewTypeEntry(l.ID, vars...)
+			t.SetJunk(l.Junk)
+			line = t
+		case "bad":
+			line = parse.NewBadLine(l.Text)
+		default:
+			return nil, fmt.Errorf("unknown kind of line %q in %s", l.Kind, f.Path)
+		}
+		eol := "\r\n"
+		for e, name := range eolNames {
+			if l.EOL == name {
+				eol = e
+			}
+		}
+		line.SetLineEnd(eol)
+		file.Lines = append(file.Lines, line)
+	}
+	return file, nil
+}
+
+// WriteTextManifest is like WriteText, but rebuilds the tree described by
+// m instead of copying a template. Messages which aren't in the manifest
+// go into missing-data.txt.
+func (s *Store) WriteTextManifest(path string, m *Manifest) error {
+	p, err := s.PlanTextManifest(path, m)
+	if err != nil {
+		return err
+	}
+	return p.Commit()
+}
+
+// PlanTextManifest works out what WriteTextManifest would do, without
+// writing anything
+func (s *Store) PlanTextManifest(path string, m *Manifest) (*staging.Plan, error) {
+	p := staging.NewPlan()
+	return p, s.planTextManifest(p, path, m)
+}
+
+func (s *Store) planTextManifest(p *staging.Plan, path string, m *Manifest) error {
+	basedir := filepath.Dir(path)
+	info, err := os.Stat(path)
+	if err == nil && info.IsDir() {
+		basedir = path
+	}
+
+	listed := map[string]bool{}
+	for _, f := range m.Files {
+		if err := checkManifestPath(f.Path); err != nil {
+			return fmt.Errorf("can't rebuild from manifest: %s", err)
+		}
+		file, err := f.build()
+		if err != nil {
+			return err
+		}
+		for _, line := range file.Lines {
+			if e, ok := line.(*parse.MessageEntry); ok {
+				listed[strings.ToLower(e.ID())] = true
+			}
+		}
+		if err := s.writeTextTo(p, filepath.Join(basedir, f.Path), file, s); err != nil {
+			return err
+		}
+	}
+
+	ids := s.MessageIDs()
+	sort.Strings(ids)
+	messages := []parse.Message{}
+	for _, id := range ids {
+		if !listed[strings.ToLower(id)] {
+			messages = append(messages, parse.Message{Id: id, Content: s.Message(id)})
+		}
+	}
+	if len(messages) > 0 {
+		missing := parse.NewFromData("// Generated by ouro-tools", messages, nil)
+		return s.writeTextTo(p, filepath.Join(basedir, "missing-data.txt"), missing, s)
+	}
+	return nil
+}
@@ -0,0 +1,111 @@
+package messagestore
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/asuffield/ouro-tools/pkg/messagestore/parse"
+)
+
+// checkRebuild writes the manifest for s, and checks that the tree it
+// was read from is rebuilt exactly from a binary copy of s
+func checkRebuild(t *testing.T, name string, s *Store, tree map[string]string) {
+	t.Helper()
+	dir := t.TempDir()
+	manifestPath := filepath.Join(dir, "manifest.json")
+	if err := s.WriteManifest(manifestPath); err != nil {
+		t.Fatal(err)
+	}
+	m, err := ReadManifest(manifestPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bin := NewStore()
+	if err := NewDecoder(bytes.NewReader(encode(t, s))).Decode(bin); err != nil {
+		t.Fatal(err)
+	}
+	out := filepath.Join(dir, "out")
+	if err := os.Mkdir(out, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := bin.WriteTextManifest(out, m); err != nil {
+		t.Fatal(err)
+	}
+
+	for file, want := range tree {
+		got, err := os.ReadFile(filepath.Join(out, file))
+		if err != nil {
+			t.Errorf("%s: %s", name, err)
+			continue
+		}
+		if string(got) != want {
+			t.Errorf("%s: %s is\n%q\nwant\n%q", name, file, got, want)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(out, "missing-data.txt")); err == nil {
+		t.Errorf("%s: wrote missing-data.txt", name)
+	}
+}
+
+// A text tree is rebuilt exactly from a binary file and its manifest
+func TestManifestRebuild(t *testing.T) {
+	for name, tree := range map[string]map[string]string{
+		"sample": sampleTree,
+		"unix": {
+			"main.txt":    "// unix\n\"hello\" \"Hello {name}\"\n\n\"multi\" <<a\nb>>\nimport sub.txt types-t.txt",
+			"sub.txt":     "\"bye\" \"Bye\"\r\n\"mixed\" \"endings\"\r",
+			"types-t.txt": "\"hello\" {name,string}\n",
+		},
+		"padding": {
+			"main.txt":    "\"hello\"\t\"Hello {name} {n}\"  // ignored\n\"tight\"\"x\"\nimport dir/sub.txt types.txt\n",
+			"dir/sub.txt": "\"bye\"   <<Bye>>;\n",
+			"types.txt":   "\"hello\"\t{ name,  string}{n,int} trailing\n",
+		},
+	} {
+		src := makeTree(t, tree)
+		checkRebuild(t, name, readStore(t, filepath.Join(src, "main.txt")), tree)
+	}
+}
+
+// Lines which couldn't be parsed are put back as they were
+func TestManifestBadLines(t *testing.T) {
+	tree := map[string]string{
+		"main.txt":  "\"hello\" \"Hello {name}\"\r\n  what is this\r\n{\r\nimport sub.txt types.txt\r\n",
+		"sub.txt":   "nonsense",
+		"types.txt": "\"hello\" {name,string}\r\n<<>>\r\n",
+	}
+	s := NewStore()
+	src := makeTree(t, tree)
+	s.BaseDir = src
+	var list parse.ErrorList
+	if err := s.Read(filepath.Join(src, "main.txt")); !errors.As(err, &list) || len(list) != 4 {
+		t.Fatalf("got %v, want four parse errors", err)
+	}
+	checkRebuild(t, "bad lines", s, tree)
+}
+
+// Manifests only describe files under the directory of the root file,
+// and nothing outside it is read or written because of one
+func TestManifestPaths(t *testing.T) {
+	tree := map[string]string{
+		"top/main.txt": "import ../sub.txt ../types.txt\n",
+		"sub.txt":      "\"bye\" \"Bye\"\n",
+		"types.txt":    "\n",
+	}
+	s := readStore(t, filepath.Join(makeTree(t, tree), "top", "main.txt"))
+	if err := s.WriteManifest(filepath.Join(t.TempDir(), "manifest.json")); err == nil {
+		t.Errorf("wrote a manifest for files outside the root directory")
+	}
+
+	for _, path := range []string{"../escape.txt", "a/../../escape.txt", "..", filepath.Join(t.TempDir(), "abs.txt")} {
+		m := &Manifest{Files: []*ManifestFile{{Path: path, Lines: []*ManifestLine{{Kind: "blank"}}}}}
+		out := t.TempDir()
+		if _, err := sampleStore(t).PlanTextManifest(out, m); err == nil {
+			t.Errorf("%s: planned a manifest file outside %s", path, out)
+		}
+	}
+}
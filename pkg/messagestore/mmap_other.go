@@ -0,0 +1,21 @@
+//go:build !(darwin || dragonfly || freebsd || linux || netbsd || openbsd)
+// +build !darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd
+
+package messagestore
+
+import (
+	"io"
+	"os"
+)
+
+// No mmap here, so just read the whole file in
+func mapFile(f *os.File) ([]byte, error) {
+	if _, err := f.Seek(0, 0); err != nil {
+		return nil, err
+	}
+	return io.ReadAll(f)
+}
+
+func unmapFile(data []byte) error {
+	return nil
+}
@@ -0,0 +1,44 @@
+package messagestore
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/asuffield/ouro-tools/pkg/messagestore/parse"
+)
+
+// A lazy store reads the same as one decoded up front, and can still be
+// modified and written out
+func TestLazyRead(t *testing.T) {
+	orig := sampleStore(t)
+	path := filepath.Join(t.TempDir(), "out.bin")
+	if err := orig.Write(path, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	s := NewStore()
+	s.Lazy = true
+	if err := s.Read(path); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if len(s.mapped) != 1 {
+		t.Errorf("mapped %d files, want 1", len(s.mapped))
+	}
+	sameContent(t, orig, s)
+
+	// Adding strings decodes the tables out of the mapping
+	for _, st := range []*Store{orig, s} {
+		msg := st.add("added", "Hello {name}!", parse.Position{})
+		st.addVars(msg, []parse.Var{{Name: "extra", Ty: "int"}})
+	}
+	sameContent(t, orig, s)
+	sameContent(t, orig, writeAndRead(t, s, "again.bin", nil))
+
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if len(s.mapped) != 0 {
+		t.Errorf("still mapped after Close")
+	}
+}
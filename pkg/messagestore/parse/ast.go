@@ -0,0 +1,292 @@
+package parse
+
+import (
+	"errors"
+	"io"
+	"strings"
+)
+
+// This is the API for reading and editing message files from outside
+// the package. Edited lines are formatted afresh, and everything else
+// keeps its original formatting.
+
+// ParseMessageFile parses a messages file, or a types file if typeFile
+// is set. Errors are an ErrorList. Lines with errors are skipped, so
+// there may still be a file returned along with them.
+func ParseMessageFile(filename string, r io.Reader, typeFile bool) (*MessageFile, error) {
+	entrypoint := "MessageFile"
+	if typeFile {
+		entrypoint = "MessageTypeFile"
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	res, err := Parse(filename, data,
+		Entrypoint(entrypoint),
+		Filename(filename),
+		Lines(data),
+		AllowInvalidUTF8(true))
+	if err != nil {
+		errs := AsErrorList(filename, err)
+		lines := newLineIndex(data)
+		for _, e := range errs {
+			if e.Line > 0 {
+				e.Line, e.Col = lines.position(e.Offset)
+			}
+		}
+		err = errs
+	}
+	mf, _ := res.(*MessageFile)
+	return mf, err
+}
+
+func NewMessageFile(typeFile bool, lines ...Line) *MessageFile {
+	return &MessageFile{
+		Lines:    lines,
+		TypeFile: typeFile,
+		// For no apparent reason, messages files have a BOM and type files do not
+		BOM: !typeFile,
+	}
+}
+
+// Append adds lines to the end of the file, making sure that the last
+// line has a line ending first
+func (f *MessageFile) Append(lines ...Line) {
+	if len(f.Lines) > 0 {
+		if n, ok := f.Lines[len(f.Lines)-1].(interface{ terminate() }); ok {
+			n.terminate()
+		}
+	}
+	f.Lines = append(f.Lines, lines...)
+}
+
+func (f *MessageFile) Format() string {
+	var str strings.Builder
+	if f.BOM {
+		str.WriteString("\uFEFF")
+	}
+	for _, line := range f.Lines {
+		str.WriteString(line.Format())
+	}
+	return str.String()
+}
+
+// FormatWith writes the file with the messages in d. Content which
+// can't be written in either string form is written as well as it can
+// be, and reported with an *EncodeError for each message.
+func (f *MessageFile) FormatWith(d MessageData) (string, error) {
+	var str strings.Builder
+	if f.BOM {
+		str.WriteString("\uFEFF")
+	}
+	errs := []error{}
+	for _, line := range f.Lines {
+		if m, ok := line.(*MessageEntry); ok {
+			s, err := m.formatWith(d)
+			if err != nil {
+				errs = append(errs, err)
+			}
+			str.WriteString(s)
+			continue
+		}
+		str.WriteString(line.FormatWith(d))
+	}
+	return str.String(), errors.Join(errs...)
+}
+
+// Walk calls fn for each line of the file in turn
+func (f *MessageFile) Walk(fn func(Line)) {
+	for _, line := range f.Lines {
+		fn(line)
+	}
+}
+
+// Rewrite replaces each line of the file with whatever fn returns for
+// it: the line itself to keep it, nothing to delete it, or several
+// lines to insert some around it
+func (f *MessageFile) Rewrite(fn func(Line) []Line) {
+	lines := []Line{}
+	for _, line := range f.Lines {
+		lines = append(lines, fn(line)...)
+	}
+	f.Lines = lines
+}
+
+// Entry finds the definition of a message, or nil
+func (f *MessageFile) Entry(id string) *MessageEntry {
+	for _, line := range f.Lines {
+		if m, ok := line.(*MessageEntry); ok && m.id == id {
+			return m
+		}
+	}
+	return nil
+}
+
+// TypeEntry finds the types of a message, or nil
+func (f *MessageFile) TypeEntry(id string) *TypeEntry {
+	for _, line := range f.Lines {
+		if t, ok := line.(*TypeEntry); ok && t.id == id {
+			return t
+		}
+	}
+	return nil
+}
+
+func NewImport(messageFile, typeFile string) *Import {
+	i, _ := newImport(messageFile, typeFile)
+	return i
+}
+
+func NewBlank() *Blank {
+	return &Blank{}
+}
+
+// The text includes the // or #
+func NewComment(text string) *Comment {
+	return &Comment{text: text}
+}
+
+func (c *Comment) Text() string {
+	return c.text
+}
+
+func (c *Comment) SetText(text string) {
+	c.text = text
+}
+
+// NewBadLine is a line which isn't anything, kept as it is
+func NewBadLine(text string) *BadLine {
+	return &BadLine{text: text}
+}
+
+func (b *BadLine) Text() string {
+	return b.text
+}
+
+// NewMessageEntry fails if content can't be written, see SetContent
+func NewMessageEntry(id, content string, multiline bool) (*MessageEntry, error) {
+	m := &MessageEntry{id: id, gap: " "}
+	if err := m.SetContent(content, multiline); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (m *MessageEntry) ID() string {
+	return m.id
+}
+
+func (m *MessageEntry) SetID(id string) {
+	m.id = id
+}
+
+// Gap is whatever is between the id and the string, usually a space
+func (m *MessageEntry) Gap() string {
+	return m.gap
+}
+
+func (m *MessageEntry) SetGap(gap string) {
+	m.gap = gap
+}
+
+// Junk is whatever follows the string on the line, which is ignored
+func (m *MessageEntry) Junk() string {
+	return m.junk
+}
+
+func (m *MessageEntry) SetJunk(junk string) {
+	m.junk = junk
+}
+
+func (m *MessageEntry) Content() string {
+	if m.message == nil {
+		return ""
+	}
+	if m.message.multiline {
+		return UnquoteMultiline(m.message.content)
+	}
+	return Unquote(m.message.content)
+}
+
+// Multiline is whether the message is written <<like this>> rather
+// than "like this"
+func (m *MessageEntry) Multiline() bool {
+	return m.message != nil && m.message.multiline
+}
+
+// SetContent uses the other form when content can't be written the way
+// that multiline asks for, so that it always reads back the same. If
+// neither form can hold it, the entry is left alone and the error is an
+// *EncodeError.
+func (m *MessageEntry) SetContent(content string, multiline bool) error {
+	s, multiline, ok := Encode(content, multiline)
+	if !ok {
+		return &EncodeError{Position: m.pos, ID: m.id, Content: content}
+	}
+	m.message = &msgString{s, multiline}
+	return nil
+}
+
+// SetMultiline requotes the message
+func (m *MessageEntry) SetMultiline(multiline bool) error {
+	if multiline != m.Multiline() {
+		return m.SetContent(m.Content(), multiline)
+	}
+	return nil
+}
+
+func NewVarType(name, ty string) *VarType {
+	return &VarType{name: name, ty: ty, junk: " "}
+}
+
+func (v *VarType) Name() string {
+	return v.name
+}
+
+func (v *VarType) Type() string {
+	return v.ty
+}
+
+func (v *VarType) SetType(ty string) {
+	v.ty = ty
+}
+
+// Padding is whatever is before the {, usually a space, and the spaces
+// after the { and after the comma
+func (v *VarType) Padding() (string, string, string) {
+	return v.junk, v.p1, v.p2
+}
+
+func (v *VarType) SetPadding(junk, p1, p2 string) {
+	v.junk, v.p1, v.p2 = junk, p1, p2
+}
+
+func NewTypeEntry(id string, vars ...*VarType) *TypeEntry {
+	return &TypeEntry{id: id, varTypes: vars}
+}
+
+func (m *TypeEntry) ID() string {
+	return m.id
+}
+
+func (m *TypeEntry) SetID(id string) {
+	m.id = id
+}
+
+func (m *TypeEntry) Vars() []*VarType {
+	return m.varTypes
+}
+
+func (m *TypeEntry) SetVars(vars ...*VarType) {
+	m.varTypes = vars
+}
+
+// Junk is whatever follows the variables on the line, which is ignored
+func (m *TypeEntry) Junk() string {
+	return m.junk
+}
+
+func (m *TypeEntry) SetJunk(junk string) {
+	m.junk = junk
+}
@@ -0,0 +1,127 @@
+package parse
+
+import (
+	"strings"
+	"testing"
+)
+
+const editText = "\uFEFF// Greetings\r\n" +
+	"\"hello\" \"Hello\"\r\n" +
+	"\"multi\" <<one\r\ntwo>>\r\n" +
+	"\"quote\"  \"Say \\\"hi\\\"\"  // kept\r\n" +
+	"import sub.txt types.txt"
+
+func parseString(t *testing.T, text string) *MessageFile {
+	t.Helper()
+	f, err := ParseMessageFile("test.txt", strings.NewReader(text), false)
+	if err != nil {
+		t.Fatalf("failed to parse %q: %s", text, err)
+	}
+	return f
+}
+
+// Only the lines which were edited are formatted afresh
+func TestRequote(t *testing.T) {
+	f := parseString(t, editText)
+	f.Walk(func(l Line) {
+		if m, ok := l.(*MessageEntry); ok {
+			if err := m.SetMultiline(!m.Multiline()); err != nil {
+				t.Fatal(err)
+			}
+		}
+	})
+	want := "\uFEFF// Greetings\r\n" +
+		"\"hello\" <<Hello>>\r\n" +
+		"\"multi\" <<one\r\ntwo>>\r\n" +
+		"\"quote\"  <<Say \"hi\">>  // kept\r\n" +
+		"import sub.txt types.txt"
+	if got := f.Format(); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	// The multiline message couldn't be quoted, so it's still the same
+	if m := f.Entry("multi"); !m.Multiline() || m.Content() != "one\r\ntwo" {
+		t.Errorf("multi is %q", m.Content())
+	}
+	if again := parseString(t, f.Format()); again.Entry("quote").Content() != "Say \"hi\"" {
+		t.Errorf("quote reads back as %q", again.Entry("quote").Content())
+	}
+}
+
+// Appending ends the last line first, since it had no line ending
+func TestAddImport(t *testing.T) {
+	f := parseString(t, editText)
+	f.Append(NewImport("more.txt", "more_types.txt"))
+	if got := f.Format(); got != editText+"\r\nimport more.txt more_types.txt\r\n" {
+		t.Errorf("got %q", got)
+	}
+}
+
+// Moving an entry takes it and its comment out of one file, and puts
+// them at the end of another
+func TestMoveEntries(t *testing.T) {
+	from := parseString(t, editText)
+	to := parseString(t, "\"bye\" \"Bye\"\n")
+
+	moved := []Line{}
+	var pending Line
+	from.Rewrite(func(l Line) []Line {
+		if c, ok := l.(*Comment); ok {
+			pending = c
+			return nil
+		}
+		keep := []Line{}
+		if pending != nil {
+			keep = append(keep, pending)
+			pending = nil
+		}
+		if m, ok := l.(*MessageEntry); ok && m.ID() == "hello" {
+			moved = append(moved, append(keep, m)...)
+			return nil
+		}
+		return append(keep, l)
+	})
+	to.Append(moved...)
+	if err := from.Entry("multi").SetContent("changed", false); err != nil {
+		t.Fatal(err)
+	}
+
+	wantFrom := "\uFEFF\"multi\" \"changed\"\r\n" +
+		"\"quote\"  \"Say \\\"hi\\\"\"  // kept\r\n" +
+		"import sub.txt types.txt"
+	if got := from.Format(); got != wantFrom {
+		t.Errorf("from is %q, want %q", got, wantFrom)
+	}
+	// The moved lines keep their own line endings
+	wantTo := "\"bye\" \"Bye\"\n" +
+		"// Greetings\r\n" +
+		"\"hello\" \"Hello\"\r\n"
+	if got := to.Format(); got != wantTo {
+		t.Errorf("to is %q, want %q", got, wantTo)
+	}
+	if strings.Contains(from.Format(), "hello") {
+		t.Errorf("hello wasn't removed")
+	}
+}
+
+// A file built from scratch formats like one that was read
+func TestNewFile(t *testing.T) {
+	hello, err := NewMessageEntry("hello", "Hello", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	multi, err := NewMessageEntry("multi", "one\r\ntwo", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := NewMessageFile(false, NewComment("// Greetings"), hello, NewBlank(), multi, NewImport("sub.txt", "types.txt"))
+	want := "\uFEFF// Greetings\r\n\"hello\" \"Hello\"\r\n\r\n\"multi\" <<one\r\ntwo>>\r\nimport sub.txt types.txt\r\n"
+	if got := f.Format(); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	types := NewMessageFile(true, NewTypeEntry("hello", NewVarType("name", "string"), NewVarType("n", "int")))
+	if got := types.Format(); got != "\"hello\" {name,string} {n,int}\r\n" {
+		t.Errorf("types are %q", got)
+	}
+}
@@ -0,0 +1,82 @@
+package parse
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ParseError is a grammar error at a position in a file
+type ParseError struct {
+	Position
+	Msg string
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Position, e.Msg)
+}
+
+// EncodeError is message content which can't be written in either
+// string form, so it wouldn't read back the same. Position is that of the
+// entry it was being written into, if that came from a file.
+type EncodeError struct {
+	Position
+	ID      string
+	Content string
+}
+
+func (e *EncodeError) Error() string {
+	msg := fmt.Sprintf("message %s can't be written as a string: %q", e.ID, e.Content)
+	if e.File == "" {
+		return msg
+	}
+	return fmt.Sprintf("%s: %s", e.Position, msg)
+}
+
+// ErrorList is all the errors from parsing one file
+type ErrorList []*ParseError
+
+func (l ErrorList) Error() string {
+	msgs := []string{}
+	for _, e := range l {
+		msgs = append(msgs, e.Error())
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// Unwrap lets errors.As find the individual ParseErrors
+func (l ErrorList) Unwrap() []error {
+	errs := []error{}
+	for _, e := range l {
+		errs = append(errs, e)
+	}
+	return errs
+}
+
+// AsErrorList converts an error returned from Parse, ParseFile or
+// ParseReader into an ErrorList
+func AsErrorList(filename string, err error) ErrorList {
+	l := ErrorList{}
+	add := func(err error) {
+		if pe, ok := err.(*parserError); ok {
+			l = append(l, &ParseError{
+				Position: Position{
+					File:   filename,
+					Line:   pe.pos.line,
+					Col:    pe.pos.col,
+					Offset: pe.pos.offset,
+				},
+				Msg: pe.Inner.Error(),
+			})
+		} else {
+			l = append(l, &ParseError{Position: Position{File: filename}, Msg: err.Error()})
+		}
+	}
+	if errs, ok := err.(errList); ok {
+		for _, err := range errs {
+			add(err)
+		}
+	} else {
+		add(err)
+	}
+	return l
+}
@@ -0,0 +1,52 @@
+package parse
+
+import (
+	"strings"
+)
+
+// There are two ways to write a message string, and neither of them has
+// a complete set of escapes, so not everything can be written both ways.
+
+// Quote writes content as a "quoted" string. Only " is escaped, and any
+// other \ stands for itself, so content which ends in \ can't be quoted,
+// and neither can anything with a line break in it.
+func Quote(content string) (string, bool) {
+	ok := !strings.ContainsAny(content, "\r\n") && !strings.HasSuffix(content, "\\")
+	return "\"" + strings.Replace(content, "\"", "\\\"", -1) + "\"", ok
+}
+
+// Unquote reverses Quote
+func Unquote(s string) string {
+	return strings.Replace(s[1:len(s)-1], "\\\"", "\"", -1)
+}
+
+// QuoteMultiline writes content as a <<multiline>> string. There are no
+// escapes at all, so the content can't contain >> or end in >.
+func QuoteMultiline(content string) (string, bool) {
+	ok := !strings.Contains(content, ">>") && !strings.HasSuffix(content, ">")
+	return "<<" + content + ">>", ok
+}
+
+// UnquoteMultiline reverses QuoteMultiline
+func UnquoteMultiline(s string) string {
+	return s[2 : len(s)-2]
+}
+
+// Encode writes content the preferred way if it can, and otherwise the
+// other way. If neither works then ok is false, and the result won't
+// read back as the same content.
+func Encode(content string, multiline bool) (s string, isMultiline bool, ok bool) {
+	for _, m := range []bool{multiline, !multiline} {
+		if m {
+			s, ok = QuoteMultiline(content)
+		} else {
+			s, ok = Quote(content)
+		}
+		if ok {
+			return s, m, true
+		}
+	}
+	// Line breaks are the worst thing to get wrong
+	s, _ = QuoteMultiline(content)
+	return s, true, false
+}
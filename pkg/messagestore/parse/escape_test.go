@@ -0,0 +1,111 @@
+package parse
+
+import (
+	"errors"
+	"testing"
+)
+
+type mapData map[string]string
+
+func (d mapData) Message(id string) string {
+	return d[id]
+}
+
+func (d mapData) HasMessage(id string) bool {
+	_, ok := d[id]
+	return ok
+}
+
+func (d mapData) MessageVarTypes(id string) map[string]string {
+	return nil
+}
+
+// checkRoundTrip writes content into each form of template entry, and
+// reads it back. Content is only allowed to fail if neither form can
+// hold it.
+func checkRoundTrip(t *testing.T, content string) {
+	t.Helper()
+	_, quoteOK := Quote(content)
+	_, multilineOK := QuoteMultiline(content)
+
+	for _, template := range []string{"\"id\" \"x\"\r\n", "\"id\" <<x>>\r\n"} {
+		out, err := parseString(t, template).FormatWith(mapData{"id": content})
+		if err != nil {
+			var ee *EncodeError
+			if !errors.As(err, &ee) || ee.ID != "id" || ee.Content != content {
+				t.Fatalf("%q: got %v, want an EncodeError", content, err)
+			}
+			if quoteOK || multilineOK {
+				t.Fatalf("%q: can be written, but got %s", content, err)
+			}
+			continue
+		}
+		if !quoteOK && !multilineOK {
+			t.Fatalf("%q: can't be written either way, but no error", content)
+		}
+
+		f := parseString(t, out)
+		if len(f.Lines) != 1 {
+			t.Fatalf("%q: wrote %q, which reads back as %d lines", content, out, len(f.Lines))
+		}
+		m, ok := f.Lines[0].(*MessageEntry)
+		if !ok || m.Content() != content {
+			t.Fatalf("%q: wrote %q, which reads back as %#v", content, out, f.Lines[0])
+		}
+		if again, err := f.FormatWith(mapData{"id": content}); err != nil || again != out {
+			t.Fatalf("%q: wrote %q, then %q, %v", content, out, again, err)
+		}
+	}
+}
+
+// Every string of up to five of the characters which matter to either
+// form, along with something which doesn't
+func TestRoundTripExhaustive(t *testing.T) {
+	alphabet := []string{"a", "\"", "\\", "<", ">", "\r", "\n"}
+	strs := []string{""}
+	for n := 0; n < 5; n++ {
+		next := []string{}
+		for _, s := range strs {
+			for _, c := range alphabet {
+				next = append(next, s+c)
+			}
+		}
+		for _, s := range next {
+			checkRoundTrip(t, s)
+		}
+		strs = next
+	}
+}
+
+func TestRoundTripUnencodable(t *testing.T) {
+	for _, content := range []string{"a>>b\\", "line\nbreak>>", "line\nbreak>", ">>\r\n"} {
+		if _, _, ok := Encode(content, false); ok {
+			t.Errorf("%q: encoded", content)
+		}
+		_, err := parseString(t, "\"id\" \"x\"\r\n").FormatWith(mapData{"id": content})
+		var ee *EncodeError
+		if !errors.As(err, &ee) {
+			t.Errorf("%q: got %v, want an EncodeError", content, err)
+		}
+
+		m, err := NewMessageEntry("id", "x", false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := m.SetContent(content, true); !errors.As(err, &ee) {
+			t.Errorf("%q: SetContent gave %v, want an EncodeError", content, err)
+		}
+		if m.Content() != "x" {
+			t.Errorf("%q: SetContent changed the entry to %q", content, m.Content())
+		}
+	}
+}
+
+func FuzzRoundTrip(f *testing.F) {
+	for _, s := range []string{"", "plain", "Hi \"there\"", "a\\", "a>>b", "line\r\nbreak", "x>", "\\\"", "<<>>"} {
+		f.Add(s)
+	}
+	f.Fuzz(func(t *testing.T, content string) {
+		checkRoundTrip(t, content)
+	})
+}
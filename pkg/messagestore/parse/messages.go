@@ -28,26 +28,30 @@ var g = &grammar{
 				expr: &seqExpr{
 					pos: position{line: 5, col: 16, offset: 34},
 					exprs: []interface{}{
-						&zeroOrOneExpr{
-							pos: position{line: 5, col: 16, offset: 34},
-							expr: &ruleRefExpr{
-								pos:  position{line: 5, col: 16, offset: 34},
-								name: "BOM",
+						&labeledExpr{
+							pos:   position{line: 5, col: 16, offset: 34},
+							label: "bom",
+							expr: &zeroOrOneExpr{
+								pos: position{line: 5, col: 20, offset: 38},
+								expr: &ruleRefExpr{
+									pos:  position{line: 5, col: 20, offset: 38},
+									name: "BOM",
+								},
 							},
 						},
 						&labeledExpr{
-							pos:   position{line: 5, col: 21, offset: 39},
+							pos:   position{line: 5, col: 25, offset: 43},
 							label: "lines",
 							expr: &zeroOrMoreExpr{
-								pos: position{line: 5, col: 27, offset: 45},
+								pos: position{line: 5, col: 31, offset: 49},
 								expr: &ruleRefExpr{
-									pos:  position{line: 5, col: 27, offset: 45},
+									pos:  position{line: 5, col: 31, offset: 49},
 									name: "MessageLine",
 								},
 							},
 						},
 						&ruleRefExpr{
-							pos:  position{line: 5, col: 40, offset: 58},
+							pos:  position{line: 5, col: 44, offset: 62},
 							name: "EOF",
 						},
 					},
@@ -56,26 +60,37 @@ var g = &grammar{
 		},
 		{
 			name: "MessageTypeFile",
-			pos:  position{line: 9, col: 1, offset: 105},
+			pos:  position{line: 9, col: 1, offset: 114},
 			expr: &actionExpr{
-				pos: position{line: 9, col: 20, offset: 124},
+				pos: position{line: 9, col: 20, offset: 133},
 				run: (*parser).callonMessageTypeFile1,
 				expr: &seqExpr{
-					pos: position{line: 9, col: 20, offset: 124},
+					pos: position{line: 9, col: 20, offset: 133},
 					exprs: []interface{}{
 						&labeledExpr{
-							pos:   position{line: 9, col: 20, offset: 124},
+							pos:   position{line: 9, col: 20, offset: 133},
+							label: "bom",
+							expr: &zeroOrOneExpr{
+								pos: position{line: 9, col: 24, offset: 137},
+								expr: &ruleRefExpr{
+									pos:  position{line: 9, col: 24, offset: 137},
+									name: "BOM",
+								},
+							},
+						},
+						&labeledExpr{
+							pos:   position{line: 9, col: 29, offset: 142},
 							label: "lines",
 							expr: &zeroOrMoreExpr{
-								pos: position{line: 9, col: 26, offset: 130},
+								pos: position{line: 9, col: 35, offset: 148},
 								expr: &ruleRefExpr{
-									pos:  position{line: 9, col: 26, offset: 130},
+									pos:  position{line: 9, col: 35, offset: 148},
 									name: "TypeLine",
 								},
 							},
 						},
 						&ruleRefExpr{
-							pos:  position{line: 9, col: 36, offset: 140},
+							pos:  position{line: 9, col: 45, offset: 158},
 							name: "EOF",
 						},
 					},
@@ -84,78 +99,124 @@ var g = &grammar{
 		},
 		{
 			name: "BOM",
-			pos:  position{line: 13, col: 1, offset: 186},
+			pos:  position{line: 13, col: 1, offset: 209},
 			expr: &litMatcher{
-				pos:        position{line: 13, col: 8, offset: 193},
+				pos:        position{line: 13, col: 8, offset: 216},
 				val:        "\ufeff",
 				ignoreCase: false,
 			},
 		},
 		{
 			name: "EOF",
-			pos:  position{line: 15, col: 1, offset: 203},
+			pos:  position{line: 15, col: 1, offset: 226},
 			expr: &notExpr{
-				pos: position{line: 15, col: 7, offset: 211},
+				pos: position{line: 15, col: 7, offset: 234},
 				expr: &anyMatcher{
-					line: 15, col: 8, offset: 212,
+					line: 15, col: 8, offset: 235,
 				},
 			},
 		},
 		{
-			name: "MessageLine",
-			pos:  position{line: 17, col: 1, offset: 215},
+			name: "EOL",
+			pos:  position{line: 19, col: 1, offset: 322},
 			expr: &actionExpr{
-				pos: position{line: 17, col: 16, offset: 230},
-				run: (*parser).callonMessageLine1,
-				expr: &seqExpr{
-					pos: position{line: 17, col: 16, offset: 230},
-					exprs: []interface{}{
-						&labeledExpr{
-							pos:   position{line: 17, col: 16, offset: 230},
-							label: "line",
-							expr: &choiceExpr{
-								pos: position{line: 17, col: 22, offset: 236},
-								alternatives: []interface{}{
-									&ruleRefExpr{
-										pos:  position{line: 17, col: 22, offset: 236},
-										name: "Blank",
-									},
-									&ruleRefExpr{
-										pos:  position{line: 17, col: 30, offset: 244},
-										name: "Comment",
-									},
-									&ruleRefExpr{
-										pos:  position{line: 17, col: 40, offset: 254},
-										name: "Import",
+				pos: position{line: 19, col: 8, offset: 329},
+				run: (*parser).callonEOL1,
+				expr: &choiceExpr{
+					pos: position{line: 19, col: 9, offset: 330},
+					alternatives: []interface{}{
+						&litMatcher{
+							pos:        position{line: 19, col: 9, offset: 330},
+							val:        "\r\n",
+							ignoreCase: false,
+						},
+						&litMatcher{
+							pos:        position{line: 19, col: 18, offset: 339},
+							val:        "\r",
+							ignoreCase: false,
+						},
+						&litMatcher{
+							pos:        position{line: 19, col: 25, offset: 346},
+							val:        "\n",
+							ignoreCase: false,
+						},
+						&ruleRefExpr{
+							pos:  position{line: 19, col: 32, offset: 353},
+							name: "EOF",
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "MessageLine",
+			pos:  position{line: 23, col: 1, offset: 392},
+			expr: &choiceExpr{
+				pos: position{line: 23, col: 16, offset: 407},
+				alternatives: []interface{}{
+					&actionExpr{
+						pos: position{line: 23, col: 16, offset: 407},
+						run: (*parser).callonMessageLine2,
+						expr: &seqExpr{
+							pos: position{line: 23, col: 16, offset: 407},
+							exprs: []interface{}{
+								&labeledExpr{
+									pos:   position{line: 23, col: 16, offset: 407},
+									label: "line",
+									expr: &choiceExpr{
+										pos: position{line: 23, col: 22, offset: 413},
+										alternatives: []interface{}{
+											&ruleRefExpr{
+												pos:  position{line: 23, col: 22, offset: 413},
+												name: "Blank",
+											},
+											&ruleRefExpr{
+												pos:  position{line: 23, col: 30, offset: 421},
+												name: "Comment",
+											},
+											&ruleRefExpr{
+												pos:  position{line: 23, col: 40, offset: 431},
+												name: "Import",
+											},
+											&ruleRefExpr{
+												pos:  position{line: 23, col: 49, offset: 440},
+												name: "Message",
+											},
+										},
 									},
-									&ruleRefExpr{
-										pos:  position{line: 17, col: 49, offset: 263},
-										name: "Message",
+								},
+								&labeledExpr{
+									pos:   position{line: 23, col: 58, offset: 449},
+									label: "eol",
+									expr: &ruleRefExpr{
+										pos:  position{line: 23, col: 62, offset: 453},
+										name: "EOL",
 									},
 								},
 							},
 						},
-						&choiceExpr{
-							pos: position{line: 17, col: 59, offset: 273},
-							alternatives: []interface{}{
-								&litMatcher{
-									pos:        position{line: 17, col: 59, offset: 273},
-									val:        "\r\n",
-									ignoreCase: false,
-								},
-								&litMatcher{
-									pos:        position{line: 17, col: 68, offset: 282},
-									val:        "\r",
-									ignoreCase: false,
-								},
-								&litMatcher{
-									pos:        position{line: 17, col: 75, offset: 289},
-									val:        "\n",
-									ignoreCase: false,
+					},
+					&actionExpr{
+						pos: position{line: 25, col: 5, offset: 504},
+						run: (*parser).callonMessageLine12,
+						expr: &seqExpr{
+							pos: position{line: 25, col: 5, offset: 504},
+							exprs: []interface{}{
+								&labeledExpr{
+									pos:   position{line: 25, col: 5, offset: 504},
+									label: "line",
+									expr: &ruleRefExpr{
+										pos:  position{line: 25, col: 10, offset: 509},
+										name: "BadLine",
+									},
 								},
-								&ruleRefExpr{
-									pos:  position{line: 17, col: 82, offset: 296},
-									name: "EOF",
+								&labeledExpr{
+									pos:   position{line: 25, col: 18, offset: 517},
+									label: "eol",
+									expr: &ruleRefExpr{
+										pos:  position{line: 25, col: 22, offset: 521},
+										name: "EOL",
+									},
 								},
 							},
 						},
@@ -165,50 +226,69 @@ var g = &grammar{
 		},
 		{
 			name: "TypeLine",
-			pos:  position{line: 21, col: 1, offset: 325},
-			expr: &actionExpr{
-				pos: position{line: 21, col: 13, offset: 337},
-				run: (*parser).callonTypeLine1,
-				expr: &seqExpr{
-					pos: position{line: 21, col: 13, offset: 337},
-					exprs: []interface{}{
-						&labeledExpr{
-							pos:   position{line: 21, col: 13, offset: 337},
-							label: "line",
-							expr: &choiceExpr{
-								pos: position{line: 21, col: 19, offset: 343},
-								alternatives: []interface{}{
-									&ruleRefExpr{
-										pos:  position{line: 21, col: 19, offset: 343},
-										name: "Blank",
-									},
-									&ruleRefExpr{
-										pos:  position{line: 21, col: 27, offset: 351},
-										name: "Comment",
+			pos:  position{line: 29, col: 1, offset: 571},
+			expr: &choiceExpr{
+				pos: position{line: 29, col: 13, offset: 583},
+				alternatives: []interface{}{
+					&actionExpr{
+						pos: position{line: 29, col: 13, offset: 583},
+						run: (*parser).callonTypeLine2,
+						expr: &seqExpr{
+							pos: position{line: 29, col: 13, offset: 583},
+							exprs: []interface{}{
+								&labeledExpr{
+									pos:   position{line: 29, col: 13, offset: 583},
+									label: "line",
+									expr: &choiceExpr{
+										pos: position{line: 29, col: 19, offset: 589},
+										alternatives: []interface{}{
+											&ruleRefExpr{
+												pos:  position{line: 29, col: 19, offset: 589},
+												name: "Blank",
+											},
+											&ruleRefExpr{
+												pos:  position{line: 29, col: 27, offset: 597},
+												name: "Comment",
+											},
+											&ruleRefExpr{
+												pos:  position{line: 29, col: 37, offset: 607},
+												name: "Type",
+											},
+										},
 									},
-									&ruleRefExpr{
-										pos:  position{line: 21, col: 37, offset: 361},
-										name: "Type",
+								},
+								&labeledExpr{
+									pos:   position{line: 29, col: 43, offset: 613},
+									label: "eol",
+									expr: &ruleRefExpr{
+										pos:  position{line: 29, col: 47, offset: 617},
+										name: "EOL",
 									},
 								},
 							},
 						},
-						&choiceExpr{
-							pos: position{line: 21, col: 44, offset: 368},
-							alternatives: []interface{}{
-								&litMatcher{
-									pos:        position{line: 21, col: 44, offset: 368},
-									val:        "\r\n",
-									ignoreCase: false,
-								},
-								&litMatcher{
-									pos:        position{line: 21, col: 53, offset: 377},
-									val:        "\n",
-									ignoreCase: false,
+					},
+					&actionExpr{
+						pos: position{line: 31, col: 5, offset: 668},
+						run: (*parser).callonTypeLine11,
+						expr: &seqExpr{
+							pos: position{line: 31, col: 5, offset: 668},
+							exprs: []interface{}{
+								&labeledExpr{
+									pos:   position{line: 31, col: 5, offset: 668},
+									label: "line",
+									expr: &ruleRefExpr{
+										pos:  position{line: 31, col: 10, offset: 673},
+										name: "BadLine",
+									},
 								},
-								&ruleRefExpr{
-									pos:  position{line: 21, col: 60, offset: 384},
-									name: "EOF",
+								&labeledExpr{
+									pos:   position{line: 31, col: 18, offset: 681},
+									label: "eol",
+									expr: &ruleRefExpr{
+										pos:  position{line: 31, col: 22, offset: 685},
+										name: "EOL",
+									},
 								},
 							},
 						},
@@ -216,16 +296,34 @@ var g = &grammar{
 				},
 			},
 		},
+		{
+			name: "BadLine",
+			pos:  position{line: 37, col: 1, offset: 846},
+			expr: &actionExpr{
+				pos: position{line: 37, col: 12, offset: 857},
+				run: (*parser).callonBadLine1,
+				expr: &oneOrMoreExpr{
+					pos: position{line: 37, col: 12, offset: 857},
+					expr: &charClassMatcher{
+						pos:        position{line: 37, col: 12, offset: 857},
+						val:        "[^\\r\\n]",
+						chars:      []rune{'\r', '\n'},
+						ignoreCase: false,
+						inverted:   true,
+					},
+				},
+			},
+		},
 		{
 			name: "Blank",
-			pos:  position{line: 25, col: 1, offset: 413},
+			pos:  position{line: 41, col: 1, offset: 907},
 			expr: &actionExpr{
-				pos: position{line: 25, col: 10, offset: 422},
+				pos: position{line: 41, col: 10, offset: 916},
 				run: (*parser).callonBlank1,
 				expr: &andExpr{
-					pos: position{line: 25, col: 10, offset: 422},
+					pos: position{line: 41, col: 10, offset: 916},
 					expr: &charClassMatcher{
-						pos:        position{line: 25, col: 11, offset: 423},
+						pos:        position{line: 41, col: 11, offset: 917},
 						val:        "[\\r\\n]",
 						chars:      []rune{'\r', '\n'},
 						ignoreCase: false,
@@ -236,32 +334,32 @@ var g = &grammar{
 		},
 		{
 			name: "Comment",
-			pos:  position{line: 29, col: 1, offset: 455},
+			pos:  position{line: 45, col: 1, offset: 949},
 			expr: &actionExpr{
-				pos: position{line: 29, col: 12, offset: 466},
+				pos: position{line: 45, col: 12, offset: 960},
 				run: (*parser).callonComment1,
 				expr: &seqExpr{
-					pos: position{line: 29, col: 12, offset: 466},
+					pos: position{line: 45, col: 12, offset: 960},
 					exprs: []interface{}{
 						&choiceExpr{
-							pos: position{line: 29, col: 13, offset: 467},
+							pos: position{line: 45, col: 13, offset: 961},
 							alternatives: []interface{}{
 								&litMatcher{
-									pos:        position{line: 29, col: 13, offset: 467},
+									pos:        position{line: 45, col: 13, offset: 961},
 									val:        "//",
 									ignoreCase: false,
 								},
 								&litMatcher{
-									pos:        position{line: 29, col: 20, offset: 474},
+									pos:        position{line: 45, col: 20, offset: 968},
 									val:        "#",
 									ignoreCase: false,
 								},
 							},
 						},
 						&zeroOrMoreExpr{
-							pos: position{line: 29, col: 25, offset: 479},
+							pos: position{line: 45, col: 25, offset: 973},
 							expr: &charClassMatcher{
-								pos:        position{line: 29, col: 25, offset: 479},
+								pos:        position{line: 45, col: 25, offset: 973},
 								val:        "[^\\r\\n]",
 								chars:      []rune{'\r', '\n'},
 								ignoreCase: false,
@@ -274,25 +372,25 @@ var g = &grammar{
 		},
 		{
 			name: "Import",
-			pos:  position{line: 33, col: 1, offset: 529},
+			pos:  position{line: 49, col: 1, offset: 1023},
 			expr: &choiceExpr{
-				pos: position{line: 34, col: 3, offset: 541},
+				pos: position{line: 50, col: 3, offset: 1035},
 				alternatives: []interface{}{
 					&actionExpr{
-						pos: position{line: 34, col: 3, offset: 541},
+						pos: position{line: 50, col: 3, offset: 1035},
 						run: (*parser).callonImport2,
 						expr: &seqExpr{
-							pos: position{line: 34, col: 3, offset: 541},
+							pos: position{line: 50, col: 3, offset: 1035},
 							exprs: []interface{}{
 								&litMatcher{
-									pos:        position{line: 34, col: 3, offset: 541},
+									pos:        position{line: 50, col: 3, offset: 1035},
 									val:        "import",
 									ignoreCase: false,
 								},
 								&oneOrMoreExpr{
-									pos: position{line: 34, col: 12, offset: 550},
+									pos: position{line: 50, col: 12, offset: 1044},
 									expr: &charClassMatcher{
-										pos:        position{line: 34, col: 12, offset: 550},
+										pos:        position{line: 50, col: 12, offset: 1044},
 										val:        "[ \\t]",
 										chars:      []rune{' ', '\t'},
 										ignoreCase: false,
@@ -300,17 +398,17 @@ var g = &grammar{
 									},
 								},
 								&labeledExpr{
-									pos:   position{line: 34, col: 19, offset: 557},
+									pos:   position{line: 50, col: 19, offset: 1051},
 									label: "messageFile",
 									expr: &ruleRefExpr{
-										pos:  position{line: 34, col: 31, offset: 569},
+										pos:  position{line: 50, col: 31, offset: 1063},
 										name: "Filename",
 									},
 								},
 								&oneOrMoreExpr{
-									pos: position{line: 34, col: 40, offset: 578},
+									pos: position{line: 50, col: 40, offset: 1072},
 									expr: &charClassMatcher{
-										pos:        position{line: 34, col: 40, offset: 578},
+										pos:        position{line: 50, col: 40, offset: 1072},
 										val:        "[ \\t]",
 										chars:      []rune{' ', '\t'},
 										ignoreCase: false,
@@ -318,10 +416,10 @@ var g = &grammar{
 									},
 								},
 								&labeledExpr{
-									pos:   position{line: 34, col: 47, offset: 585},
+									pos:   position{line: 50, col: 47, offset: 1079},
 									label: "typeFile",
 									expr: &ruleRefExpr{
-										pos:  position{line: 34, col: 56, offset: 594},
+										pos:  position{line: 50, col: 56, offset: 1088},
 										name: "Filename",
 									},
 								},
@@ -329,20 +427,20 @@ var g = &grammar{
 						},
 					},
 					&actionExpr{
-						pos: position{line: 36, col: 5, offset: 673},
+						pos: position{line: 52, col: 5, offset: 1167},
 						run: (*parser).callonImport13,
 						expr: &seqExpr{
-							pos: position{line: 36, col: 5, offset: 673},
+							pos: position{line: 52, col: 5, offset: 1167},
 							exprs: []interface{}{
 								&litMatcher{
-									pos:        position{line: 36, col: 5, offset: 673},
+									pos:        position{line: 52, col: 5, offset: 1167},
 									val:        "import",
 									ignoreCase: false,
 								},
 								&oneOrMoreExpr{
-									pos: position{line: 36, col: 14, offset: 682},
+									pos: position{line: 52, col: 14, offset: 1176},
 									expr: &charClassMatcher{
-										pos:        position{line: 36, col: 14, offset: 682},
+										pos:        position{line: 52, col: 14, offset: 1176},
 										val:        "[ \\t]",
 										chars:      []rune{' ', '\t'},
 										ignoreCase: false,
@@ -350,10 +448,10 @@ var g = &grammar{
 									},
 								},
 								&labeledExpr{
-									pos:   position{line: 36, col: 21, offset: 689},
+									pos:   position{line: 52, col: 21, offset: 1183},
 									label: "messageFile",
 									expr: &ruleRefExpr{
-										pos:  position{line: 36, col: 33, offset: 701},
+										pos:  position{line: 52, col: 33, offset: 1195},
 										name: "Filename",
 									},
 								},
@@ -365,14 +463,14 @@ var g = &grammar{
 		},
 		{
 			name: "Filename",
-			pos:  position{line: 39, col: 1, offset: 762},
+			pos:  position{line: 55, col: 1, offset: 1256},
 			expr: &actionExpr{
-				pos: position{line: 39, col: 13, offset: 774},
+				pos: position{line: 55, col: 13, offset: 1268},
 				run: (*parser).callonFilename1,
 				expr: &oneOrMoreExpr{
-					pos: position{line: 39, col: 13, offset: 774},
+					pos: position{line: 55, col: 13, offset: 1268},
 					expr: &charClassMatcher{
-						pos:        position{line: 39, col: 13, offset: 774},
+						pos:        position{line: 55, col: 13, offset: 1268},
 						val:        "[^ \\t\\r\\n]",
 						chars:      []rune{' ', '\t', '\r', '\n'},
 						ignoreCase: false,
@@ -383,38 +481,38 @@ var g = &grammar{
 		},
 		{
 			name: "Message",
-			pos:  position{line: 43, col: 1, offset: 820},
+			pos:  position{line: 59, col: 1, offset: 1314},
 			expr: &actionExpr{
-				pos: position{line: 43, col: 12, offset: 831},
+				pos: position{line: 59, col: 12, offset: 1325},
 				run: (*parser).callonMessage1,
 				expr: &seqExpr{
-					pos: position{line: 43, col: 12, offset: 831},
+					pos: position{line: 59, col: 12, offset: 1325},
 					exprs: []interface{}{
 						&litMatcher{
-							pos:        position{line: 43, col: 12, offset: 831},
+							pos:        position{line: 59, col: 12, offset: 1325},
 							val:        "\"",
 							ignoreCase: false,
 						},
 						&labeledExpr{
-							pos:   position{line: 43, col: 16, offset: 835},
+							pos:   position{line: 59, col: 16, offset: 1329},
 							label: "id",
 							expr: &ruleRefExpr{
-								pos:  position{line: 43, col: 19, offset: 838},
+								pos:  position{line: 59, col: 19, offset: 1332},
 								name: "MessageID",
 							},
 						},
 						&litMatcher{
-							pos:        position{line: 43, col: 29, offset: 848},
+							pos:        position{line: 59, col: 29, offset: 1342},
 							val:        "\"",
 							ignoreCase: false,
 						},
 						&labeledExpr{
-							pos:   position{line: 43, col: 33, offset: 852},
+							pos:   position{line: 59, col: 33, offset: 1346},
 							label: "gap",
 							expr: &zeroOrMoreExpr{
-								pos: position{line: 43, col: 37, offset: 856},
+								pos: position{line: 59, col: 37, offset: 1350},
 								expr: &charClassMatcher{
-									pos:        position{line: 43, col: 37, offset: 856},
+									pos:        position{line: 59, col: 37, offset: 1350},
 									val:        "[^\"<\\r\\n]",
 									chars:      []rune{'"', '<', '\r', '\n'},
 									ignoreCase: false,
@@ -423,29 +521,29 @@ var g = &grammar{
 							},
 						},
 						&labeledExpr{
-							pos:   position{line: 43, col: 48, offset: 867},
+							pos:   position{line: 59, col: 48, offset: 1361},
 							label: "message",
 							expr: &choiceExpr{
-								pos: position{line: 43, col: 57, offset: 876},
+								pos: position{line: 59, col: 57, offset: 1370},
 								alternatives: []interface{}{
 									&ruleRefExpr{
-										pos:  position{line: 43, col: 57, offset: 876},
+										pos:  position{line: 59, col: 57, offset: 1370},
 										name: "String",
 									},
 									&ruleRefExpr{
-										pos:  position{line: 43, col: 66, offset: 885},
+										pos:  position{line: 59, col: 66, offset: 1379},
 										name: "MultilineString",
 									},
 								},
 							},
 						},
 						&labeledExpr{
-							pos:   position{line: 43, col: 83, offset: 902},
+							pos:   position{line: 59, col: 83, offset: 1396},
 							label: "junk",
 							expr: &zeroOrMoreExpr{
-								pos: position{line: 43, col: 88, offset: 907},
+								pos: position{line: 59, col: 88, offset: 1401},
 								expr: &charClassMatcher{
-									pos:        position{line: 43, col: 88, offset: 907},
+									pos:        position{line: 59, col: 88, offset: 1401},
 									val:        "[^\\r\\n]",
 									chars:      []rune{'\r', '\n'},
 									ignoreCase: false,
@@ -459,49 +557,49 @@ var g = &grammar{
 		},
 		{
 			name: "Type",
-			pos:  position{line: 47, col: 1, offset: 965},
+			pos:  position{line: 63, col: 1, offset: 1459},
 			expr: &actionExpr{
-				pos: position{line: 47, col: 9, offset: 973},
+				pos: position{line: 63, col: 9, offset: 1467},
 				run: (*parser).callonType1,
 				expr: &seqExpr{
-					pos: position{line: 47, col: 9, offset: 973},
+					pos: position{line: 63, col: 9, offset: 1467},
 					exprs: []interface{}{
 						&litMatcher{
-							pos:        position{line: 47, col: 9, offset: 973},
+							pos:        position{line: 63, col: 9, offset: 1467},
 							val:        "\"",
 							ignoreCase: false,
 						},
 						&labeledExpr{
-							pos:   position{line: 47, col: 13, offset: 977},
+							pos:   position{line: 63, col: 13, offset: 1471},
 							label: "id",
 							expr: &ruleRefExpr{
-								pos:  position{line: 47, col: 16, offset: 980},
+								pos:  position{line: 63, col: 16, offset: 1474},
 								name: "MessageID",
 							},
 						},
 						&litMatcher{
-							pos:        position{line: 47, col: 26, offset: 990},
+							pos:        position{line: 63, col: 26, offset: 1484},
 							val:        "\"",
 							ignoreCase: false,
 						},
 						&labeledExpr{
-							pos:   position{line: 47, col: 30, offset: 994},
+							pos:   position{line: 63, col: 30, offset: 1488},
 							label: "vars",
 							expr: &zeroOrMoreExpr{
-								pos: position{line: 47, col: 35, offset: 999},
+								pos: position{line: 63, col: 35, offset: 1493},
 								expr: &ruleRefExpr{
-									pos:  position{line: 47, col: 35, offset: 999},
+									pos:  position{line: 63, col: 35, offset: 1493},
 									name: "VariableType",
 								},
 							},
 						},
 						&labeledExpr{
-							pos:   position{line: 47, col: 49, offset: 1013},
+							pos:   position{line: 63, col: 49, offset: 1507},
 							label: "junk",
 							expr: &zeroOrMoreExpr{
-								pos: position{line: 47, col: 54, offset: 1018},
+								pos: position{line: 63, col: 54, offset: 1512},
 								expr: &charClassMatcher{
-									pos:        position{line: 47, col: 54, offset: 1018},
+									pos:        position{line: 63, col: 54, offset: 1512},
 									val:        "[^\\r\\n]",
 									chars:      []rune{'\r', '\n'},
 									ignoreCase: false,
@@ -515,23 +613,23 @@ var g = &grammar{
 		},
 		{
 			name: "VariableType",
-			pos:  position{line: 51, col: 1, offset: 1072},
+			pos:  position{line: 67, col: 1, offset: 1566},
 			expr: &choiceExpr{
-				pos: position{line: 52, col: 3, offset: 1090},
+				pos: position{line: 68, col: 3, offset: 1584},
 				alternatives: []interface{}{
 					&actionExpr{
-						pos: position{line: 52, col: 3, offset: 1090},
+						pos: position{line: 68, col: 3, offset: 1584},
 						run: (*parser).callonVariableType2,
 						expr: &seqExpr{
-							pos: position{line: 52, col: 3, offset: 1090},
+							pos: position{line: 68, col: 3, offset: 1584},
 							exprs: []interface{}{
 								&labeledExpr{
-									pos:   position{line: 52, col: 3, offset: 1090},
+									pos:   position{line: 68, col: 3, offset: 1584},
 									label: "junk",
 									expr: &zeroOrMoreExpr{
-										pos: position{line: 52, col: 8, offset: 1095},
+										pos: position{line: 68, col: 8, offset: 1589},
 										expr: &charClassMatcher{
-											pos:        position{line: 52, col: 8, offset: 1095},
+											pos:        position{line: 68, col: 8, offset: 1589},
 											val:        "[^{\\r\\n]",
 											chars:      []rune{'{', '\r', '\n'},
 											ignoreCase: false,
@@ -540,29 +638,29 @@ var g = &grammar{
 									},
 								},
 								&litMatcher{
-									pos:        position{line: 52, col: 18, offset: 1105},
+									pos:        position{line: 68, col: 18, offset: 1599},
 									val:        "{",
 									ignoreCase: false,
 								},
 								&labeledExpr{
-									pos:   position{line: 52, col: 22, offset: 1109},
+									pos:   position{line: 68, col: 22, offset: 1603},
 									label: "p1",
 									expr: &zeroOrMoreExpr{
-										pos: position{line: 52, col: 25, offset: 1112},
+										pos: position{line: 68, col: 25, offset: 1606},
 										expr: &litMatcher{
-											pos:        position{line: 52, col: 25, offset: 1112},
+											pos:        position{line: 68, col: 25, offset: 1606},
 											val:        " ",
 											ignoreCase: false,
 										},
 									},
 								},
 								&labeledExpr{
-									pos:   position{line: 52, col: 30, offset: 1117},
+									pos:   position{line: 68, col: 30, offset: 1611},
 									label: "name",
 									expr: &zeroOrMoreExpr{
-										pos: position{line: 52, col: 35, offset: 1122},
+										pos: position{line: 68, col: 35, offset: 1616},
 										expr: &charClassMatcher{
-											pos:        position{line: 52, col: 35, offset: 1122},
+											pos:        position{line: 68, col: 35, offset: 1616},
 											val:        "[^,}\\r\\n]",
 											chars:      []rune{',', '}', '\r', '\n'},
 											ignoreCase: false,
@@ -571,29 +669,29 @@ var g = &grammar{
 									},
 								},
 								&litMatcher{
-									pos:        position{line: 52, col: 46, offset: 1133},
+									pos:        position{line: 68, col: 46, offset: 1627},
 									val:        ",",
 									ignoreCase: false,
 								},
 								&labeledExpr{
-									pos:   position{line: 52, col: 50, offset: 1137},
+									pos:   position{line: 68, col: 50, offset: 1631},
 									label: "p2",
 									expr: &zeroOrMoreExpr{
-										pos: position{line: 52, col: 53, offset: 1140},
+										pos: position{line: 68, col: 53, offset: 1634},
 										expr: &litMatcher{
-											pos:        position{line: 52, col: 53, offset: 1140},
+											pos:        position{line: 68, col: 53, offset: 1634},
 											val:        " ",
 											ignoreCase: false,
 										},
 									},
 								},
 								&labeledExpr{
-									pos:   position{line: 52, col: 58, offset: 1145},
+									pos:   position{line: 68, col: 58, offset: 1639},
 									label: "ty",
 									expr: &zeroOrMoreExpr{
-										pos: position{line: 52, col: 61, offset: 1148},
+										pos: position{line: 68, col: 61, offset: 1642},
 										expr: &charClassMatcher{
-											pos:        position{line: 52, col: 61, offset: 1148},
+											pos:        position{line: 68, col: 61, offset: 1642},
 											val:        "[^}\\r\\n]",
 											chars:      []rune{'}', '\r', '\n'},
 											ignoreCase: false,
@@ -602,7 +700,7 @@ var g = &grammar{
 									},
 								},
 								&litMatcher{
-									pos:        position{line: 52, col: 71, offset: 1158},
+									pos:        position{line: 68, col: 71, offset: 1652},
 									val:        "}",
 									ignoreCase: false,
 								},
@@ -610,18 +708,18 @@ var g = &grammar{
 						},
 					},
 					&actionExpr{
-						pos: position{line: 54, col: 3, offset: 1214},
+						pos: position{line: 70, col: 3, offset: 1722},
 						run: (*parser).callonVariableType22,
 						expr: &seqExpr{
-							pos: position{line: 54, col: 3, offset: 1214},
+							pos: position{line: 70, col: 3, offset: 1722},
 							exprs: []interface{}{
 								&labeledExpr{
-									pos:   position{line: 54, col: 3, offset: 1214},
+									pos:   position{line: 70, col: 3, offset: 1722},
 									label: "junk",
 									expr: &zeroOrMoreExpr{
-										pos: position{line: 54, col: 8, offset: 1219},
+										pos: position{line: 70, col: 8, offset: 1727},
 										expr: &charClassMatcher{
-											pos:        position{line: 54, col: 8, offset: 1219},
+											pos:        position{line: 70, col: 8, offset: 1727},
 											val:        "[^{\\r\\n]",
 											chars:      []rune{'{', '\r', '\n'},
 											ignoreCase: false,
@@ -630,29 +728,29 @@ var g = &grammar{
 									},
 								},
 								&litMatcher{
-									pos:        position{line: 54, col: 18, offset: 1229},
+									pos:        position{line: 70, col: 18, offset: 1737},
 									val:        "{",
 									ignoreCase: false,
 								},
 								&labeledExpr{
-									pos:   position{line: 54, col: 22, offset: 1233},
+									pos:   position{line: 70, col: 22, offset: 1741},
 									label: "p1",
 									expr: &zeroOrMoreExpr{
-										pos: position{line: 54, col: 25, offset: 1236},
+										pos: position{line: 70, col: 25, offset: 1744},
 										expr: &litMatcher{
-											pos:        position{line: 54, col: 25, offset: 1236},
+											pos:        position{line: 70, col: 25, offset: 1744},
 											val:        " ",
 											ignoreCase: false,
 										},
 									},
 								},
 								&labeledExpr{
-									pos:   position{line: 54, col: 30, offset: 1241},
+									pos:   position{line: 70, col: 30, offset: 1749},
 									label: "name",
 									expr: &zeroOrMoreExpr{
-										pos: position{line: 54, col: 35, offset: 1246},
+										pos: position{line: 70, col: 35, offset: 1754},
 										expr: &charClassMatcher{
-											pos:        position{line: 54, col: 35, offset: 1246},
+											pos:        position{line: 70, col: 35, offset: 1754},
 											val:        "[^,}\\r\\n]",
 											chars:      []rune{',', '}', '\r', '\n'},
 											ignoreCase: false,
@@ -661,7 +759,7 @@ var g = &grammar{
 									},
 								},
 								&litMatcher{
-									pos:        position{line: 54, col: 46, offset: 1257},
+									pos:        position{line: 70, col: 46, offset: 1765},
 									val:        "}",
 									ignoreCase: false,
 								},
@@ -673,14 +771,14 @@ var g = &grammar{
 		},
 		{
 			name: "MessageID",
-			pos:  position{line: 57, col: 1, offset: 1314},
+			pos:  position{line: 73, col: 1, offset: 1836},
 			expr: &actionExpr{
-				pos: position{line: 57, col: 14, offset: 1327},
+				pos: position{line: 73, col: 14, offset: 1849},
 				run: (*parser).callonMessageID1,
 				expr: &oneOrMoreExpr{
-					pos: position{line: 57, col: 14, offset: 1327},
+					pos: position{line: 73, col: 14, offset: 1849},
 					expr: &charClassMatcher{
-						pos:        position{line: 57, col: 14, offset: 1327},
+						pos:        position{line: 73, col: 14, offset: 1849},
 						val:        "[^\"\\r\\n]",
 						chars:      []rune{'"', '\r', '\n'},
 						ignoreCase: false,
@@ -691,67 +789,67 @@ var g = &grammar{
 		},
 		{
 			name: "String",
-			pos:  position{line: 62, col: 1, offset: 1441},
+			pos:  position{line: 78, col: 1, offset: 1963},
 			expr: &actionExpr{
-				pos: position{line: 62, col: 11, offset: 1451},
+				pos: position{line: 78, col: 11, offset: 1973},
 				run: (*parser).callonString1,
 				expr: &seqExpr{
-					pos: position{line: 62, col: 11, offset: 1451},
+					pos: position{line: 78, col: 11, offset: 1973},
 					exprs: []interface{}{
 						&litMatcher{
-							pos:        position{line: 62, col: 11, offset: 1451},
+							pos:        position{line: 78, col: 11, offset: 1973},
 							val:        "\"",
 							ignoreCase: false,
 						},
 						&zeroOrMoreExpr{
-							pos: position{line: 62, col: 15, offset: 1455},
+							pos: position{line: 78, col: 15, offset: 1977},
 							expr: &choiceExpr{
-								pos: position{line: 63, col: 3, offset: 1459},
+								pos: position{line: 79, col: 3, offset: 1981},
 								alternatives: []interface{}{
 									&charClassMatcher{
-										pos:        position{line: 63, col: 3, offset: 1459},
+										pos:        position{line: 79, col: 3, offset: 1981},
 										val:        "[^\"\\\\\\r\\n]",
 										chars:      []rune{'"', '\\', '\r', '\n'},
 										ignoreCase: false,
 										inverted:   true,
 									},
 									&seqExpr{
-										pos: position{line: 64, col: 5, offset: 1520},
+										pos: position{line: 80, col: 5, offset: 2042},
 										exprs: []interface{}{
 											&litMatcher{
-												pos:        position{line: 64, col: 5, offset: 1520},
+												pos:        position{line: 80, col: 5, offset: 2042},
 												val:        "\\",
 												ignoreCase: false,
 											},
 											&litMatcher{
-												pos:        position{line: 64, col: 10, offset: 1525},
+												pos:        position{line: 80, col: 10, offset: 2047},
 												val:        "\"",
 												ignoreCase: false,
 											},
 										},
 									},
 									&litMatcher{
-										pos:        position{line: 65, col: 5, offset: 1566},
+										pos:        position{line: 81, col: 5, offset: 2088},
 										val:        "\\",
 										ignoreCase: false,
 									},
 									&seqExpr{
-										pos: position{line: 66, col: 5, offset: 1618},
+										pos: position{line: 82, col: 5, offset: 2140},
 										exprs: []interface{}{
 											&litMatcher{
-												pos:        position{line: 66, col: 5, offset: 1618},
+												pos:        position{line: 82, col: 5, offset: 2140},
 												val:        "\"",
 												ignoreCase: false,
 											},
 											&andExpr{
-												pos: position{line: 66, col: 9, offset: 1622},
+												pos: position{line: 82, col: 9, offset: 2144},
 												expr: &seqExpr{
-													pos: position{line: 66, col: 12, offset: 1625},
+													pos: position{line: 82, col: 12, offset: 2147},
 													exprs: []interface{}{
 														&zeroOrMoreExpr{
-															pos: position{line: 66, col: 12, offset: 1625},
+															pos: position{line: 82, col: 12, offset: 2147},
 															expr: &charClassMatcher{
-																pos:        position{line: 66, col: 12, offset: 1625},
+																pos:        position{line: 82, col: 12, offset: 2147},
 																val:        "[^\\r\\n\"]",
 																chars:      []rune{'\r', '\n', '"'},
 																ignoreCase: false,
@@ -759,7 +857,7 @@ var g = &grammar{
 															},
 														},
 														&litMatcher{
-															pos:        position{line: 66, col: 22, offset: 1635},
+															pos:        position{line: 82, col: 22, offset: 2157},
 															val:        "\"",
 															ignoreCase: false,
 														},
@@ -772,7 +870,7 @@ var g = &grammar{
 							},
 						},
 						&litMatcher{
-							pos:        position{line: 67, col: 6, offset: 1733},
+							pos:        position{line: 83, col: 6, offset: 2255},
 							val:        "\"",
 							ignoreCase: false,
 						},
@@ -782,38 +880,38 @@ var g = &grammar{
 		},
 		{
 			name: "MultilineString",
-			pos:  position{line: 71, col: 1, offset: 1777},
+			pos:  position{line: 87, col: 1, offset: 2299},
 			expr: &actionExpr{
-				pos: position{line: 71, col: 20, offset: 1796},
+				pos: position{line: 87, col: 20, offset: 2318},
 				run: (*parser).callonMultilineString1,
 				expr: &seqExpr{
-					pos: position{line: 71, col: 20, offset: 1796},
+					pos: position{line: 87, col: 20, offset: 2318},
 					exprs: []interface{}{
 						&litMatcher{
-							pos:        position{line: 71, col: 20, offset: 1796},
+							pos:        position{line: 87, col: 20, offset: 2318},
 							val:        "<<",
 							ignoreCase: false,
 						},
 						&labeledExpr{
-							pos:   position{line: 71, col: 25, offset: 1801},
+							pos:   position{line: 87, col: 25, offset: 2323},
 							label: "content",
 							expr: &zeroOrMoreExpr{
-								pos: position{line: 71, col: 33, offset: 1809},
+								pos: position{line: 87, col: 33, offset: 2331},
 								expr: &choiceExpr{
-									pos: position{line: 71, col: 35, offset: 1811},
+									pos: position{line: 87, col: 35, offset: 2333},
 									alternatives: []interface{}{
 										&seqExpr{
-											pos: position{line: 71, col: 35, offset: 1811},
+											pos: position{line: 87, col: 35, offset: 2333},
 											exprs: []interface{}{
 												&litMatcher{
-													pos:        position{line: 71, col: 35, offset: 1811},
+													pos:        position{line: 87, col: 35, offset: 2333},
 													val:        ">",
 													ignoreCase: false,
 												},
 												&notExpr{
-													pos: position{line: 71, col: 39, offset: 1815},
+													pos: position{line: 87, col: 39, offset: 2337},
 													expr: &litMatcher{
-														pos:        position{line: 71, col: 40, offset: 1816},
+														pos:        position{line: 87, col: 40, offset: 2338},
 														val:        ">",
 														ignoreCase: false,
 													},
@@ -821,7 +919,7 @@ var g = &grammar{
 											},
 										},
 										&charClassMatcher{
-											pos:        position{line: 71, col: 46, offset: 1822},
+											pos:        position{line: 87, col: 46, offset: 2344},
 											val:        "[^>]",
 											chars:      []rune{'>'},
 											ignoreCase: false,
@@ -832,7 +930,7 @@ var g = &grammar{
 							},
 						},
 						&litMatcher{
-							pos:        position{line: 71, col: 54, offset: 1830},
+							pos:        position{line: 87, col: 54, offset: 2352},
 							val:        ">>",
 							ignoreCase: false,
 						},
@@ -843,44 +941,84 @@ var g = &grammar{
 	},
 }
 
-func (c *current) onMessageFile1(lines interface{}) (interface{}, error) {
-	return newMessageFile(lines, false)
+func (c *current) onMessageFile1(bom, lines interface{}) (interface{}, error) {
+	return newMessageFile(bom, lines, false)
 }
 
 func (p *parser) callonMessageFile1() (interface{}, error) {
 	stack := p.vstack[len(p.vstack)-1]
 	_ = stack
-	return p.cur.onMessageFile1(stack["lines"])
+	return p.cur.onMessageFile1(stack["bom"], stack["lines"])
 }
 
-func (c *current) onMessageTypeFile1(lines interface{}) (interface{}, error) {
-	return newMessageFile(lines, true)
+func (c *current) onMessageTypeFile1(bom, lines interface{}) (interface{}, error) {
+	return newMessageFile(bom, lines, true)
 }
 
 func (p *parser) callonMessageTypeFile1() (interface{}, error) {
 	stack := p.vstack[len(p.vstack)-1]
 	_ = stack
-	return p.cur.onMessageTypeFile1(stack["lines"])
+	return p.cur.onMessageTypeFile1(stack["bom"], stack["lines"])
+}
+
+func (c *current) onEOL1() (interface{}, error) {
+	return string(c.text), nil
+}
+
+func (p *parser) callonEOL1() (interface{}, error) {
+	stack := p.vstack[len(p.vstack)-1]
+	_ = stack
+	return p.cur.onEOL1()
+}
+
+func (c *current) onMessageLine2(line, eol interface{}) (interface{}, error) {
+	return setPos(line, c.position(), eol)
+}
+
+func (p *parser) callonMessageLine2() (interface{}, error) {
+	stack := p.vstack[len(p.vstack)-1]
+	_ = stack
+	return p.cur.onMessageLine2(stack["line"], stack["eol"])
+}
+
+func (c *current) onMessageLine12(line, eol interface{}) (interface{}, error) {
+	return setPos(line, c.position(), eol)
+}
+
+func (p *parser) callonMessageLine12() (interface{}, error) {
+	stack := p.vstack[len(p.vstack)-1]
+	_ = stack
+	return p.cur.onMessageLine12(stack["line"], stack["eol"])
+}
+
+func (c *current) onTypeLine2(line, eol interface{}) (interface{}, error) {
+	return setPos(line, c.position(), eol)
+}
+
+func (p *parser) callonTypeLine2() (interface{}, error) {
+	stack := p.vstack[len(p.vstack)-1]
+	_ = stack
+	return p.cur.onTypeLine2(stack["line"], stack["eol"])
 }
 
-func (c *current) onMessageLine1(line interface{}) (interface{}, error) {
-	return line, nil
+func (c *current) onTypeLine11(line, eol interface{}) (interface{}, error) {
+	return setPos(line, c.position(), eol)
 }
 
-func (p *parser) callonMessageLine1() (interface{}, error) {
+func (p *parser) callonTypeLine11() (interface{}, error) {
 	stack := p.vstack[len(p.vstack)-1]
 	_ = stack
-	return p.cur.onMessageLine1(stack["line"])
+	return p.cur.onTypeLine11(stack["line"], stack["eol"])
 }
 
-func (c *current) onTypeLine1(line interface{}) (interface{}, error) {
-	return line, nil
+func (c *current) onBadLine1() (interface{}, error) {
+	return newBadLine(string(c.text))
 }
 
-func (p *parser) callonTypeLine1() (interface{}, error) {
+func (p *parser) callonBadLine1() (interface{}, error) {
 	stack := p.vstack[len(p.vstack)-1]
 	_ = stack
-	return p.cur.onTypeLine1(stack["line"])
+	return p.cur.onBadLine1()
 }
 
 func (c *current) onBlank1() (interface{}, error) {
@@ -954,7 +1092,7 @@ func (p *parser) callonType1() (interface{}, error) {
 }
 
 func (c *current) onVariableType2(junk, p1, name, p2, ty interface{}) (interface{}, error) {
-	return newVarType(name, ty, junk, p1, p2)
+	return newVarType(c.position(), name, ty, junk, p1, p2)
 }
 
 func (p *parser) callonVariableType2() (interface{}, error) {
@@ -964,7 +1102,7 @@ func (p *parser) callonVariableType2() (interface{}, error) {
 }
 
 func (c *current) onVariableType22(junk, p1, name interface{}) (interface{}, error) {
-	return newVarType(name, nil, junk, p1, nil)
+	return newVarType(c.position(), name, nil, junk, p1, nil)
 }
 
 func (p *parser) callonVariableType22() (interface{}, error) {
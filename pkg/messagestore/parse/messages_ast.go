@@ -4,13 +4,17 @@ package parse
 //go:generate mv messages.go.tmp messages.go
 
 import (
+	"bytes"
 	"fmt"
+	"sort"
 	"strings"
+	"unicode/utf8"
 )
 
 type MessageFile struct {
 	Lines    []Line
 	TypeFile bool
+	BOM      bool
 }
 
 type MessageData interface {
@@ -19,7 +23,14 @@ type MessageData interface {
 	MessageVarTypes(string) map[string]string
 }
 
+// MessageData can also say where each message was defined, so that
+// later duplicate definitions (which are ignored) can be left alone
+type MessageDefinitions interface {
+	MessageDefinition(string) (Position, bool)
+}
+
 type Line interface {
+	Pos() Position
 	Format() string
 	FormatWith(MessageData) string
 	Messages() []Message
@@ -40,23 +51,149 @@ type Var struct {
 	Name, Ty string
 }
 
+// Position is where something starts in a source file. Col counts
+// characters and Offset counts bytes.
+type Position struct {
+	File      string
+	Line, Col int
+	Offset    int
+}
+
+func (p Position) String() string {
+	return fmt.Sprintf("%s:%d:%d", p.File, p.Line, p.Col)
+}
+
+// Filename sets the name of the file being parsed, for the positions
+// of the nodes in the tree
+func Filename(name string) Option {
+	return GlobalStore("filename", name)
+}
+
+// Lines sets the text being parsed, so that positions can be worked out
+// from it. The parser's own count doesn't know about \r line endings,
+// and puts each \n at the start of the next line.
+func Lines(data []byte) Option {
+	return GlobalStore("lines", newLineIndex(data))
+}
+
+func (c *current) position() Position {
+	file, _ := c.globalStore["filename"].(string)
+	pos := Position{
+		File:   file,
+		Line:   c.pos.line,
+		Col:    c.pos.col,
+		Offset: c.pos.offset,
+	}
+	if lines, ok := c.globalStore["lines"].(*lineIndex); ok {
+		pos.Line, pos.Col = lines.position(pos.Offset)
+	}
+	return pos
+}
+
+// lineIndex is where each line of some text starts
+type lineIndex struct {
+	data   []byte
+	starts []int
+}
+
+func newLineIndex(data []byte) *lineIndex {
+	// The BOM isn't part of the first line
+	start := 0
+	if bytes.HasPrefix(data, []byte("\uFEFF")) {
+		start = len("\uFEFF")
+	}
+	l := &lineIndex{data: data, starts: []int{start}}
+	for i := start; i < len(data); i++ {
+		switch {
+		case data[i] == '\r' && i+1 < len(data) && data[i+1] == '\n':
+			i++
+			l.starts = append(l.starts, i+1)
+		case data[i] == '\r' || data[i] == '\n':
+			l.starts = append(l.starts, i+1)
+		}
+	}
+	return l
+}
+
+// position gives the line and column of a byte offset, counting from 1
+func (l *lineIndex) position(offset int) (int, int) {
+	i := sort.Search(len(l.starts), func(i int) bool { return l.starts[i] > offset }) - 1
+	if i < 0 {
+		// In the BOM
+		return 1, 1
+	}
+	return i + 1, utf8.RuneCount(l.data[l.starts[i]:offset]) + 1
+}
+
+// node is the position of a node in the tree, and for lines, how the
+// line ended. They're zero for nodes that didn't come from a file.
+type node struct {
+	pos    Position
+	eol    string
+	hasEOL bool
+}
+
+func (n *node) Pos() Position {
+	return n.pos
+}
+
+func setPos(line interface{}, pos Position, eol interface{}) (Line, error) {
+	l := line.(Line)
+	if n, ok := l.(interface{ setPos(Position, string) }); ok {
+		n.setPos(pos, eol.(string))
+	}
+	return l, nil
+}
+
+func (n *node) setPos(pos Position, eol string) {
+	n.pos = pos
+	n.eol = eol
+	n.hasEOL = true
+}
+
+// New lines end with \r\n, like the rest of the format. The last line
+// of a file might not have an ending at all.
+func (n *node) lineEnd() string {
+	if n.hasEOL {
+		return n.eol
+	}
+	return "\r\n"
+}
+
+// LineEnd is how the line ends: "\r\n", "\r", "\n", or nothing at the
+// end of a file without a final line break
+func (n *node) LineEnd() string {
+	return n.lineEnd()
+}
+
+func (n *node) SetLineEnd(eol string) {
+	n.eol = eol
+	n.hasEOL = true
+}
+
+func (n *node) terminate() {
+	if n.hasEOL && n.eol == "" {
+		n.eol = "\r\n"
+	}
+}
+
 // Reconstruct an AST from some data, when we don't have a template
 func NewFromData(header string, messages []Message, types []Type) *MessageFile {
-	lines := []Line{&comment{comment: header}}
+	lines := []Line{&Comment{text: header}}
 	for _, m := range messages {
-		lines = append(lines, &message{id: m.Id, gap: " "})
+		lines = append(lines, &MessageEntry{id: m.Id, gap: " "})
 	}
 
 	// There is no valid format for this, but we'll emit what we can
 	for _, t := range types {
-		vars := []*varType{}
+		vars := []*VarType{}
 		for _, v := range t.Vars {
-			vars = append(vars, &varType{name: v.Name, ty: v.Ty})
+			vars = append(vars, &VarType{name: v.Name, ty: v.Ty})
 		}
-		ty := &messageType{id: t.Id, varTypes: vars}
-		lines = append(lines, &comment{comment: fmt.Sprintf("// TYPE: %s", ty.Format())})
+		ty := &TypeEntry{id: t.Id, varTypes: vars}
+		lines = append(lines, &Comment{text: fmt.Sprintf("// TYPE: %s", ty.Format())})
 	}
-	return &MessageFile{Lines: lines}
+	return &MessageFile{Lines: lines, BOM: true}
 }
 
 func toIfaceSlice(v interface{}) []interface{} {
@@ -78,15 +215,16 @@ func toFlatString(v interface{}) string {
 	return str.String()
 }
 
-func newMessageFile(messages interface{}, types bool) (*MessageFile, error) {
+func newMessageFile(bom, messages interface{}, types bool) (*MessageFile, error) {
 	ms := []Line{}
 	for _, m := range toIfaceSlice(messages) {
 		ms = append(ms, m.(Line))
 	}
-	return &MessageFile{ms, types}, nil
+	return &MessageFile{Lines: ms, TypeFile: types, BOM: bom != nil}, nil
 }
 
 type empty struct {
+	node
 }
 
 func (*empty) Messages() []Message {
@@ -97,6 +235,7 @@ func (*empty) Types() []Type {
 	return []Type{}
 }
 
+// Import loads another messages file, and optionally its types file
 type Import struct {
 	empty
 	MessageFile, TypeFile string
@@ -104,9 +243,9 @@ type Import struct {
 
 func (i *Import) Format() string {
 	if i.TypeFile != "" {
-		return fmt.Sprintf("import %s %s\r\n", i.MessageFile, i.TypeFile)
+		return fmt.Sprintf("import %s %s%s", i.MessageFile, i.TypeFile, i.lineEnd())
 	} else {
-		return fmt.Sprintf("import %s\r\n", i.MessageFile)
+		return fmt.Sprintf("import %s%s", i.MessageFile, i.lineEnd())
 	}
 }
 
@@ -121,40 +260,63 @@ func newImport(messageFile, typeFile string) (*Import, error) {
 	}, nil
 }
 
-type blank struct {
+// Blank is an empty line
+type Blank struct {
 	empty
 }
 
-func newBlank() (*blank, error) {
-	return &blank{}, nil
+func newBlank() (*Blank, error) {
+	return &Blank{}, nil
 }
 
-func (*blank) Format() string {
-	return "\r\n"
+func (b *Blank) Format() string {
+	return b.lineEnd()
 }
 
-func (b *blank) FormatWith(_ MessageData) string {
+func (b *Blank) FormatWith(_ MessageData) string {
 	return b.Format()
 }
 
-type comment struct {
+// Comment is a whole line comment, starting with // or #
+type Comment struct {
 	empty
-	comment string
+	text string
 }
 
-func newComment(c string) (*comment, error) {
-	return &comment{comment: c}, nil
+func newComment(c string) (*Comment, error) {
+	return &Comment{text: c}, nil
 }
 
-func (c *comment) Format() string {
-	return fmt.Sprintf("%s\r\n", c.comment)
+func (c *Comment) Format() string {
+	return fmt.Sprintf("%s%s", c.text, c.lineEnd())
 }
 
-func (c *comment) FormatWith(_ MessageData) string {
+func (c *Comment) FormatWith(_ MessageData) string {
 	return c.Format()
 }
 
-type message struct {
+// BadLine is a line which could not be parsed, kept so that the rest of
+// the file can still be used
+type BadLine struct {
+	empty
+	text string
+}
+
+func newBadLine(text string) (*BadLine, error) {
+	return &BadLine{text: text}, fmt.Errorf("can't parse line %q", text)
+}
+
+func (b *BadLine) Format() string {
+	return fmt.Sprintf("%s%s", b.text, b.lineEnd())
+}
+
+func (b *BadLine) FormatWith(_ MessageData) string {
+	return b.Format()
+}
+
+// MessageEntry is a message definition, in a messages file
+type MessageEntry struct {
+	node
 	id        string
 	message   *msgString
 	gap, junk string
@@ -164,43 +326,52 @@ type messageString interface {
 	Content() string
 }
 
-func (m *message) Format() string {
-	return fmt.Sprintf("\"%s\"%s%s%s\r\n", m.id, m.gap, m.message.Format(), m.junk)
+func (m *MessageEntry) Format() string {
+	return fmt.Sprintf("\"%s\"%s%s%s%s", m.id, m.gap, m.message.Format(), m.junk, m.lineEnd())
+}
+
+func (m *MessageEntry) FormatWith(d MessageData) string {
+	s, _ := m.formatWith(d)
+	return s
 }
 
-func (m *message) FormatWith(d MessageData) string {
+func (m *MessageEntry) formatWith(d MessageData) (string, error) {
 	if !d.HasMessage(m.id) {
-		return fmt.Sprintf("// %s", m.Format())
+		return fmt.Sprintf("// %s", m.Format()), nil
+	}
+	if defs, ok := d.(MessageDefinitions); ok && m.pos.Line > 0 {
+		if pos, ok := defs.MessageDefinition(m.id); ok && pos != m.pos {
+			// Only the first definition counts, leave the others alone
+			return m.Format(), nil
+		}
 	}
 	content := d.Message(m.id)
 
-	if (m.message != nil && m.message.multiline) || strings.ContainsAny(content, "\r\n") {
-		return fmt.Sprintf("\"%s\"%s<<%s>>%s\r\n", m.id, m.gap, content, m.junk)
-	} else {
-		return fmt.Sprintf("\"%s\"%s\"%s\"%s\r\n", m.id, m.gap, content, m.junk)
+	// Write the string exactly as it was if it hasn't changed. Otherwise
+	// keep the form from the template, unless it can't hold the content.
+	var err error
+	str := m.message.Format()
+	if m.message == nil || m.Content() != content {
+		var ok bool
+		if str, _, ok = Encode(content, m.Multiline()); !ok {
+			err = &EncodeError{Position: m.pos, ID: m.id, Content: content}
+		}
 	}
+	return fmt.Sprintf("\"%s\"%s%s%s%s", m.id, m.gap, str, m.junk, m.lineEnd()), err
 }
 
-func (m *message) Messages() []Message {
-	var content string
-	if m.message.multiline {
-		// Remove the << and >>
-		content = m.message.content[2 : len(m.message.content)-2]
-	} else {
-		// Remove the "" and replace all \" with "
-		content = strings.Replace(m.message.content[1:len(m.message.content)-1], "\\\"", "\"", -1)
-	}
+func (m *MessageEntry) Messages() []Message {
 	return []Message{
-		Message{m.id, content},
+		Message{m.id, m.Content()},
 	}
 }
 
-func (m *message) Types() []Type {
+func (m *MessageEntry) Types() []Type {
 	return []Type{}
 }
 
-func newMessage(id, gap, m, junk interface{}) (*message, error) {
-	return &message{
+func newMessage(id, gap, m, junk interface{}) (*MessageEntry, error) {
+	return &MessageEntry{
 		id:      id.(string),
 		message: m.(*msgString),
 		gap:     toFlatString(gap),
@@ -229,11 +400,13 @@ func newMultilineString(content string) (*msgString, error) {
 	return &msgString{content, true}, nil
 }
 
-type varType struct {
+// VarType is the type of one variable in a TypeEntry
+type VarType struct {
+	node
 	name, ty, junk, p1, p2 string
 }
 
-func (s *varType) Format() string {
+func (s *VarType) Format() string {
 	if s.p2 != "" || s.ty != "" {
 		return fmt.Sprintf("%s{%s%s,%s%s}", s.junk, s.p1, s.name, s.p2, s.ty)
 	} else {
@@ -241,7 +414,7 @@ func (s *varType) Format() string {
 	}
 }
 
-func (s *varType) FormatWith(ty string) string {
+func (s *VarType) FormatWith(ty string) string {
 	if s.p2 != "" || ty != "" {
 		return fmt.Sprintf("%s{%s%s,%s%s}", s.junk, s.p1, s.name, s.p2, ty)
 	} else {
@@ -249,8 +422,9 @@ func (s *varType) FormatWith(ty string) string {
 	}
 }
 
-func newVarType(name, ty, junk, p1, p2 interface{}) (*varType, error) {
-	return &varType{
+func newVarType(pos Position, name, ty, junk, p1, p2 interface{}) (*VarType, error) {
+	return &VarType{
+		node: node{pos: pos},
 		name: toFlatString(name),
 		ty:   toFlatString(ty),
 		junk: toFlatString(junk),
@@ -259,24 +433,26 @@ func newVarType(name, ty, junk, p1, p2 interface{}) (*varType, error) {
 	}, nil
 }
 
-type messageType struct {
+// TypeEntry gives the types of the variables in a message, in a types file
+type TypeEntry struct {
+	node
 	id       string
-	varTypes []*varType
+	varTypes []*VarType
 	junk     string
 }
 
-func (m *messageType) Format() string {
+func (m *TypeEntry) Format() string {
 	var str strings.Builder
 	str.WriteString(fmt.Sprintf("\"%s\"", m.id))
 	for _, t := range m.varTypes {
 		str.WriteString(t.Format())
 	}
 	str.WriteString(m.junk)
-	str.WriteString("\r\n")
+	str.WriteString(m.lineEnd())
 	return str.String()
 }
 
-func (m *messageType) FormatWith(d MessageData) string {
+func (m *TypeEntry) FormatWith(d MessageData) string {
 	var id string
 	// Find a message for this type which exists, because that's where
 	// the data will be stored. It could have gone into any of these
@@ -301,15 +477,15 @@ func (m *messageType) FormatWith(d MessageData) string {
 		}
 	}
 	str.WriteString(m.junk)
-	str.WriteString("\r\n")
+	str.WriteString(m.lineEnd())
 	return str.String()
 }
 
-func (m *messageType) Messages() []Message {
+func (m *TypeEntry) Messages() []Message {
 	return []Message{}
 }
 
-func (m *messageType) Types() []Type {
+func (m *TypeEntry) Types() []Type {
 	vars := []Var{}
 	for _, v := range m.varTypes {
 		vars = append(vars, Var{v.name, v.ty})
@@ -319,12 +495,12 @@ func (m *messageType) Types() []Type {
 	}
 }
 
-func newMessageType(id, varsI, junk interface{}) (*messageType, error) {
-	vs := []*varType{}
+func newMessageType(id, varsI, junk interface{}) (*TypeEntry, error) {
+	vs := []*VarType{}
 	for _, v := range toIfaceSlice(varsI) {
-		vs = append(vs, v.(*varType))
+		vs = append(vs, v.(*VarType))
 	}
-	return &messageType{
+	return &TypeEntry{
 		id:       id.(string),
 		varTypes: vs,
 		junk:     toFlatString(junk),
@@ -0,0 +1,70 @@
+package parse
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// Every bad line is reported, and the rest of the file is still there,
+// with the bad lines kept as they were
+func TestBadLines(t *testing.T) {
+	text := "\"a\" \"A\"\r\n  junk\r\n\"b\" \"B\"\r\n\"c\" oops\r\n\r\n{not a line}"
+	f, err := ParseMessageFile("m.txt", strings.NewReader(text), false)
+
+	var list ErrorList
+	if !errors.As(err, &list) {
+		t.Fatalf("got %v, want an ErrorList", err)
+	}
+	want := []Position{
+		{File: "m.txt", Line: 2, Col: 1, Offset: 9},
+		{File: "m.txt", Line: 4, Col: 1, Offset: 26},
+		{File: "m.txt", Line: 6, Col: 1, Offset: 38},
+	}
+	if len(list) != len(want) {
+		t.Fatalf("got %d errors, want %d:\n%s", len(list), len(want), err)
+	}
+	for i, pe := range list {
+		if pe.Position != want[i] {
+			t.Errorf("error %d is at %+v, want %+v", i, pe.Position, want[i])
+		}
+		if !strings.HasPrefix(pe.Msg, "can't parse line") {
+			t.Errorf("error %d is %q", i, pe.Msg)
+		}
+	}
+
+	if f == nil {
+		t.Fatal("no file returned along with the errors")
+	}
+	if f.Entry("a") == nil || f.Entry("b") == nil || f.Entry("c") != nil {
+		t.Errorf("entries are wrong in %#v", f.Lines)
+	}
+	bad := []string{}
+	f.Walk(func(l Line) {
+		if b, ok := l.(*BadLine); ok {
+			bad = append(bad, b.Text())
+		}
+	})
+	if strings.Join(bad, "|") != "  junk|\"c\" oops|{not a line}" {
+		t.Errorf("bad lines are %q", bad)
+	}
+	if got := f.Format(); got != text {
+		t.Errorf("formatted as %q, want %q", got, text)
+	}
+}
+
+func TestBadTypeLines(t *testing.T) {
+	text := "\"a\" {n,int}\nnonsense\n\"b\" {m,string}\n<<>>\n"
+	f, err := ParseMessageFile("t.txt", strings.NewReader(text), true)
+
+	var list ErrorList
+	if !errors.As(err, &list) || len(list) != 2 || list[0].Line != 2 || list[1].Line != 4 {
+		t.Fatalf("got %v, want errors on lines 2 and 4", err)
+	}
+	if f == nil || f.TypeEntry("a") == nil || f.TypeEntry("b") == nil {
+		t.Fatalf("type entries are missing from %#v", f)
+	}
+	if got := f.Format(); got != text {
+		t.Errorf("formatted as %q, want %q", got, text)
+	}
+}
@@ -0,0 +1,74 @@
+package parse
+
+import (
+	"strings"
+	"testing"
+)
+
+type wantPos struct {
+	line, col, offset int
+}
+
+func checkPos(t *testing.T, what string, got Position, file string, want wantPos) {
+	t.Helper()
+	if got != (Position{File: file, Line: want.line, Col: want.col, Offset: want.offset}) {
+		t.Errorf("%s is at %+v, want %s:%d:%d offset %d", what, got, file, want.line, want.col, want.offset)
+	}
+}
+
+// Col counts characters and Offset counts bytes, so they differ after
+// anything outside ASCII, and after the BOM
+func TestPositions(t *testing.T) {
+	for _, eol := range []string{"\r\n", "\n", "\r"} {
+		lines := []string{
+			"\"é\" \"É\"",
+			"",
+			"// ñ",
+			"import a.txt b.txt",
+			"\"m\" <<x" + eol + "y>>",
+			"  junk",
+			"\"ñ\"\t\"Z\"",
+		}
+		text := "\uFEFF" + strings.Join(lines, eol)
+		f, _ := ParseMessageFile("m.txt", strings.NewReader(text), false)
+		if len(f.Lines) != len(lines) {
+			t.Fatalf("%q: got %d lines, want %d", eol, len(f.Lines), len(lines))
+		}
+
+		line, offset := 1, len("\uFEFF")
+		for i, l := range f.Lines {
+			checkPos(t, l.Format(), l.Pos(), "m.txt", wantPos{line, 1, offset})
+			line += 1 + strings.Count(lines[i], eol)
+			offset += len(lines[i]) + len(eol)
+		}
+	}
+}
+
+func TestVarTypePositions(t *testing.T) {
+	text := "\"é\" {ñ,int} {b, string}\n\"x\"{y,int}\n"
+	f, err := ParseMessageFile("t.txt", strings.NewReader(text), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkPos(t, "é", f.Lines[0].Pos(), "t.txt", wantPos{1, 1, 0})
+	checkPos(t, "x", f.Lines[1].Pos(), "t.txt", wantPos{2, 1, 26})
+
+	// Each variable starts with the space before it
+	vars := f.TypeEntry("é").Vars()
+	checkPos(t, "ñ", vars[0].Pos(), "t.txt", wantPos{1, 4, 4})
+	checkPos(t, "b", vars[1].Pos(), "t.txt", wantPos{1, 12, 13})
+	checkPos(t, "y", f.TypeEntry("x").Vars()[0].Pos(), "t.txt", wantPos{2, 4, 29})
+}
+
+// Nodes made by hand haven't come from anywhere
+func TestNewNodePositions(t *testing.T) {
+	m, err := NewMessageEntry("id", "text", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, l := range []Line{m, NewBlank(), NewComment("// c"), NewImport("a", "b"), NewTypeEntry("id", NewVarType("n", "int"))} {
+		if l.Pos() != (Position{}) {
+			t.Errorf("%q is at %+v", l.Format(), l.Pos())
+		}
+	}
+}
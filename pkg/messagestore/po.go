@@ -0,0 +1,288 @@
+package messagestore
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/asuffield/ouro-tools/pkg/messagestore/parse"
+	"github.com/asuffield/ouro-tools/pkg/staging"
+)
+
+// gettext catalogs, for translators. Each message is an entry with the
+// message id as its msgctxt, the source text as its msgid and the
+// translation as its msgstr. Variable types and the comments before the
+// message in the source go in extracted (#.) comments.
+//
+// A .pot has no translations. A .po written with a template has the
+// template's text as the source, and the store's text as the
+// translation. Reading a .po takes the translation of each message, or
+// the source text when there isn't one.
+type poFormat struct {
+	pot bool
+}
+
+func init() {
+	RegisterFormat(poFormat{pot: false})
+	RegisterFormat(poFormat{pot: true})
+}
+
+func (f poFormat) Name() string {
+	if f.pot {
+		return "pot"
+	}
+	return "po"
+}
+
+func (f poFormat) Detect(path string, head []byte) bool {
+	return strings.HasSuffix(path, "."+f.Name())
+}
+
+const poTypesPrefix = "types: "
+
+func (f poFormat) Write(p *staging.Plan, s *Store, path string, template *Store) error {
+	source := s
+	if template != nil {
+		source = template
+	}
+	comments := source.comments()
+
+	var b bytes.Buffer
+	b.WriteString("msgid \"\"\n")
+	b.WriteString("msgstr \"\"\n")
+	b.WriteString("\"Content-Type: text/plain; charset=UTF-8\\n\"\n")
+	b.WriteString("\"Content-Transfer-Encoding: 8bit\\n\"\n")
+	b.WriteString("\"X-Generator: ouro-tools\\n\"\n")
+
+	ids := s.MessageIDs()
+	source.sourceOrder(ids)
+	for _, id := range ids {
+		b.WriteString("\n")
+		for _, c := range comments[strings.ToLower(id)] {
+			fmt.Fprintf(&b, "#. %s\n", commentText(c))
+		}
+		if vars := s.MessageVars(id); len(vars) > 0 {
+			fmt.Fprintf(&b, "#. %s%s\n", poTypesPrefix, formatVars(vars))
+		}
+		if pos, ok := source.MessageDefinition(id); ok {
+			fmt.Fprintf(&b, "#: %s:%d\n", pos.File, pos.Line)
+		}
+
+		text, translation := s.Message(id), ""
+		if template != nil && template.HasMessage(id) {
+			text, translation = template.Message(id), s.Message(id)
+		}
+		if f.pot || translation == text {
+			// Reads back the same, and shows up as untranslated
+			translation = ""
+		}
+		writePOString(&b, "msgctxt", id)
+		writePOString(&b, "msgid", text)
+		writePOString(&b, "msgstr", translation)
+	}
+
+	return p.Add(path, b.Bytes(), len(ids))
+}
+
+func writePOString(w io.Writer, keyword, s string) {
+	lines := strings.SplitAfter(s, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	if len(lines) <= 1 {
+		fmt.Fprintf(w, "%s \"%s\"\n", keyword, poEscape(s))
+		return
+	}
+	fmt.Fprintf(w, "%s \"\"\n", keyword)
+	for _, l := range lines {
+		fmt.Fprintf(w, "\"%s\"\n", poEscape(l))
+	}
+}
+
+func poEscape(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch r {
+		case '\\':
+			b.WriteString(`\\`)
+		case '"':
+			b.WriteString(`\"`)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\r':
+			b.WriteString(`\r`)
+		case '\t':
+			b.WriteString(`\t`)
+		default:
+			if r < 0x20 {
+				fmt.Fprintf(&b, `\%03o`, r)
+			} else {
+				b.WriteRune(r)
+			}
+		}
+	}
+	return b.String()
+}
+
+// poEntry is one entry of a catalog as it is read
+type poEntry struct {
+	pos             parse.Position
+	ctxt, id, str   string
+	hasCtxt, hasStr bool
+	fuzzy           bool
+	comments        []string
+	field           *string
+}
+
+func (f poFormat) Read(s *Store, path string) error {
+	r, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	errs := parse.ErrorList{}
+	fail := func(pos parse.Position, format string, args ...interface{}) {
+		errs = append(errs, &parse.ParseError{Position: pos, Msg: fmt.Sprintf(format, args...)})
+	}
+
+	var e *poEntry
+	flush := func() {
+		if e == nil {
+			return
+		}
+		entry := e
+		e = nil
+		if !entry.hasCtxt {
+			if entry.id != "" {
+				fail(entry.pos, "entry %q has no msgctxt to give its message id", entry.id)
+			}
+			// Otherwise it's the header
+			return
+		}
+		content := entry.str
+		if content == "" || entry.fuzzy {
+			content = entry.id
+		}
+		msg := s.add(entry.ctxt, content, parse.Position{})
+		if msg == nil {
+			fail(entry.pos, "duplicate message %s", entry.ctxt)
+			return
+		}
+		for _, c := range entry.comments {
+			if !strings.HasPrefix(c, poTypesPrefix) {
+				continue
+			}
+			s.addVars(msg, parseVars(c))
+		}
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1<<20)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		pos := parse.Position{File: path, Line: n, Col: 1}
+		if n == 1 {
+			line = strings.TrimPrefix(line, "\uFEFF")
+		}
+
+		// A comment or keyword after the msgstr starts the next entry
+		start := func() {
+			if e != nil && e.hasStr {
+				flush()
+			}
+			if e == nil {
+				e = &poEntry{pos: pos}
+			}
+		}
+
+		switch {
+		case line == "":
+			flush()
+		case strings.HasPrefix(line, "#~"):
+			// Obsolete entries are ignored
+		case strings.HasPrefix(line, "#."):
+			start()
+			e.comments = append(e.comments, strings.TrimSpace(line[2:]))
+		case strings.HasPrefix(line, "#,"):
+			start()
+			for _, flag := range strings.Split(line[2:], ",") {
+				if strings.TrimSpace(flag) == "fuzzy" {
+					e.fuzzy = true
+				}
+			}
+		case strings.HasPrefix(line, "#"):
+			start()
+		case strings.HasPrefix(line, `"`):
+			if e == nil || e.field == nil {
+				fail(pos, "string %s isn't part of anything", line)
+				continue
+			}
+			str, err := poUnquote(line)
+			if err != nil {
+				fail(pos, "%s", err)
+				continue
+			}
+			*e.field += str
+		default:
+			keyword := line
+			value := ""
+			if i := strings.IndexAny(line, " \t"); i >= 0 {
+				keyword, value = line[:i], strings.TrimSpace(line[i:])
+			}
+			start()
+			var discard string
+			switch keyword {
+			case "msgctxt":
+				e.field = &e.ctxt
+				e.hasCtxt = true
+			case "msgid":
+				e.field = &e.id
+			case "msgstr", "msgstr[0]":
+				e.field = &e.str
+				e.hasStr = true
+			case "msgid_plural":
+				// There are no plurals in messagestore
+				e.field = &discard
+			default:
+				if strings.HasPrefix(keyword, "msgstr[") {
+					e.field = &discard
+					e.hasStr = true
+					break
+				}
+				fail(pos, "unknown keyword %s", keyword)
+				e.field = nil
+				continue
+			}
+			str, err := poUnquote(value)
+			if err != nil {
+				fail(pos, "%s", err)
+				continue
+			}
+			*e.field = str
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read %s: %s", path, err)
+	}
+	flush()
+
+	return parseErrors(errs, nil)
+}
+
+func poUnquote(s string) (string, error) {
+	if len(s) < 2 || s[0] != '"' || s[len(s)-1] != '"' {
+		return "", fmt.Errorf("expected a quoted string, got %s", s)
+	}
+	// Go's quoting is close enough to C's, apart from some escapes which
+	// gettext doesn't produce
+	str, err := strconv.Unquote(s)
+	if err != nil {
+		return "", fmt.Errorf("bad string %s: %s", s, err)
+	}
+	return str, nil
+}
@@ -0,0 +1,49 @@
+package messagestore
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPORoundTrip(t *testing.T) {
+	s := trickyStore(t)
+	for _, name := range []string{"out.po", "out.pot"} {
+		sameContent(t, s, writeAndRead(t, s, name, nil))
+	}
+}
+
+// With a template, the translations are what's read back
+func TestPOTranslation(t *testing.T) {
+	template := sampleStore(t)
+	s := translatedStore(t)
+
+	path := filepath.Join(t.TempDir(), "fr.po")
+	if err := s.Write(path, template); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "msgid \"Hello {name}!\"\nmsgstr \"Bonjour {name}!\"\n") {
+		t.Errorf("no translation of hello in:\n%s", data)
+	}
+	sameContent(t, s, readStore(t, path))
+}
+
+// Fuzzy and untranslated entries take the source text
+func TestPOFuzzy(t *testing.T) {
+	dir := makeTree(t, map[string]string{"fr.po": "msgid \"\"\nmsgstr \"\"\n\n" +
+		"#, fuzzy\nmsgctxt \"a\"\nmsgid \"A\"\nmsgstr \"Ah\"\n\n" +
+		"msgctxt \"b\"\nmsgid \"B\"\nmsgstr \"\"\n\n" +
+		"msgctxt \"c\"\nmsgid \"C\"\nmsgstr \"\"\n\"C\\n\"\n\"two\"\n",
+	})
+	s := readStore(t, filepath.Join(dir, "fr.po"))
+	for id, want := range map[string]string{"a": "A", "b": "B", "c": "C\ntwo"} {
+		if got := s.Message(id); got != want {
+			t.Errorf("%s is %q, want %q", id, got, want)
+		}
+	}
+}
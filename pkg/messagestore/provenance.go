@@ -0,0 +1,87 @@
+package messagestore
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/asuffield/ouro-tools/pkg/messagestore/parse"
+)
+
+// comments finds the block of whole line comments just before the
+// definition of each message in the text files read into the store.
+// Keyed by lower case id.
+func (s *Store) comments() map[string][]string {
+	names := []string{}
+	for name := range s.inputFiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	comments := map[string][]string{}
+	for _, name := range names {
+		var pending []string
+		s.inputFiles[name].Walk(func(line parse.Line) {
+			switch l := line.(type) {
+			case *parse.Comment:
+				pending = append(pending, l.Text())
+				return
+			case *parse.MessageEntry:
+				if pos, ok := s.MessageDefinition(l.ID()); ok && pos == l.Pos() && len(pending) > 0 {
+					comments[strings.ToLower(l.ID())] = pending
+				}
+			}
+			pending = nil
+		})
+	}
+	return comments
+}
+
+// commentText strips the // or # from a comment
+func commentText(c string) string {
+	if strings.HasPrefix(c, "//") {
+		c = c[2:]
+	} else {
+		c = strings.TrimPrefix(c, "#")
+	}
+	return strings.TrimSpace(c)
+}
+
+// sourceOrder sorts ids by the file and place they were defined in, with any
+// which didn't come from text at the end
+func (s *Store) sourceOrder(ids []string) {
+	sort.SliceStable(ids, func(i, j int) bool {
+		a, aok := s.MessageDefinition(ids[i])
+		b, bok := s.MessageDefinition(ids[j])
+		switch {
+		case aok != bok:
+			return aok
+		case !aok:
+			return ids[i] < ids[j]
+		case a.File != b.File:
+			return a.File < b.File
+		}
+		return a.Offset < b.Offset
+	})
+}
+
+// formatVars writes variables the way a types file does, for formats
+// which keep them as text
+func formatVars(vars []parse.Var) string {
+	strs := []string{}
+	for _, v := range vars {
+		strs = append(strs, fmt.Sprintf("{%s,%s}", v.Name, v.Ty))
+	}
+	return strings.Join(strs, " ")
+}
+
+var varPattern = regexp.MustCompile(`\{([^,}]*),([^}]*)\}`)
+
+func parseVars(s string) []parse.Var {
+	vars := []parse.Var{}
+	for _, m := range varPattern.FindAllStringSubmatch(s, -1) {
+		vars = append(vars, parse.Var{Name: m[1], Ty: m[2]})
+	}
+	return vars
+}
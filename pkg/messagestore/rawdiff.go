@@ -0,0 +1,188 @@
+package messagestore
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/asuffield/ouro-tools/pkg/stringtable"
+)
+
+// How a table in a binary file spends its bytes
+type tableStats struct {
+	count, bytes int
+	// Strings stored more than once, and the bytes spent on the copies
+	duplicates, duplicateBytes int
+	// Strings which no message refers to, and the bytes they take
+	unreferenced, unreferencedBytes int
+}
+
+func newTableStats(t *stringtable.Table, l *TableLayout, referenced map[int]bool) tableStats {
+	st := tableStats{count: t.Len(), bytes: l.Len}
+	seen := map[string]bool{}
+	for i := 0; i < t.Len(); i++ {
+		v := t.Get(i)
+		if seen[v] {
+			st.duplicates++
+			st.duplicateBytes += len(v) + 1
+		}
+		seen[v] = true
+		if !referenced[i] {
+			st.unreferenced++
+			st.unreferencedBytes += len(v) + 1
+		}
+	}
+	return st
+}
+
+type rawStats struct {
+	size                    int64
+	messages, variables     tableStats
+	recordBytes             int64
+	fileHash, content, full string
+}
+
+func newRawStats(s *Store, l *Layout, data []byte) rawStats {
+	messageRefs := map[int]bool{}
+	variableRefs := map[int]bool{}
+	for _, r := range l.Records {
+		messageRefs[int(r.Index)] = true
+		messageRefs[int(r.HelpIndex)] = true
+		for _, i := range r.VarIndices {
+			variableRefs[int(i)] = true
+			variableRefs[int(i)+1] = true
+		}
+	}
+
+	st := rawStats{
+		size:      l.Size,
+		messages:  newTableStats(s.messageTable, l.Tables[0], messageRefs),
+		variables: newTableStats(s.variableTable, l.Tables[1], variableRefs),
+	}
+	st.recordBytes = l.Size - l.MessageCountOffset
+
+	h := sha256.Sum256(data)
+	st.fileHash = hex.EncodeToString(h[:])
+	st.content = storeHash(s, true)
+	st.full = storeHash(s, false)
+	return st
+}
+
+func storeHash(s *Store, contentOnly bool) string {
+	h := sha256.New()
+	s.Hash(h, contentOnly)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func diffLine(w io.Writer, what string, a, b int64) {
+	if a == b {
+		fmt.Fprintf(w, "%s: %d\n", what, a)
+	} else {
+		fmt.Fprintf(w, "%s: %d -> %d (%+d)\n", what, a, b, b-a)
+	}
+}
+
+func diffTables(w io.Writer, name string, a, b tableStats) {
+	diffLine(w, fmt.Sprintf("%s table bytes", name), int64(a.bytes), int64(b.bytes))
+	diffLine(w, "  strings", int64(a.count), int64(b.count))
+	diffLine(w, "  duplicate strings", int64(a.duplicates), int64(b.duplicates))
+	diffLine(w, "  bytes in duplicates", int64(a.duplicateBytes), int64(b.duplicateBytes))
+	diffLine(w, "  unreferenced strings", int64(a.unreferenced), int64(b.unreferenced))
+	diffLine(w, "  bytes in unreferenced strings", int64(a.unreferencedBytes), int64(b.unreferencedBytes))
+}
+
+func diffHash(w io.Writer, what, a, b string) {
+	if a == b {
+		fmt.Fprintf(w, "%s: same %s\n", what, a)
+	} else {
+		fmt.Fprintf(w, "%s: %s -> %s\n", what, a, b)
+	}
+}
+
+// RawDiff explains how two binary files, each read with ReadLayout,
+// differ in structure rather than content
+func RawDiff(w io.Writer, a, b *Store, la, lb *Layout, dataA, dataB []byte) {
+	if len(la.Tables) != 2 || len(lb.Tables) != 2 {
+		fmt.Fprintf(w, "can only compare complete files\n")
+		return
+	}
+	sa := newRawStats(a, la, dataA)
+	sb := newRawStats(b, lb, dataB)
+
+	diffLine(w, "file size", sa.size, sb.size)
+	diffTables(w, "messages", sa.messages, sb.messages)
+	diffTables(w, "variable", sa.variables, sb.variables)
+	diffLine(w, "message record bytes", sa.recordBytes, sb.recordBytes)
+	diffLine(w, "  records", int64(len(la.Records)), int64(len(lb.Records)))
+
+	// Index assignments and record order, for the messages in both
+	byID := map[string]*Record{}
+	order := map[string]int{}
+	for i, r := range lb.Records {
+		byID[r.ID] = r
+		order[r.ID] = i
+	}
+	inA := map[string]bool{}
+	onlyA := []string{}
+	onlyB := []string{}
+	moved := []string{}
+	reindexed := []string{}
+	for i, r := range la.Records {
+		inA[r.ID] = true
+		other, ok := byID[r.ID]
+		if !ok {
+			onlyA = append(onlyA, r.ID)
+			continue
+		}
+		if order[r.ID] != i {
+			moved = append(moved, fmt.Sprintf("%s: record %d -> %d", r.ID, i, order[r.ID]))
+		}
+		if r.Index != other.Index || r.HelpIndex != other.HelpIndex || !sameIndices(r.VarIndices, other.VarIndices) {
+			reindexed = append(reindexed, fmt.Sprintf("%s: index %d -> %d, help index %d -> %d, variables %v -> %v",
+				r.ID, r.Index, other.Index, r.HelpIndex, other.HelpIndex, r.VarIndices, other.VarIndices))
+		}
+	}
+	for _, r := range lb.Records {
+		if !inA[r.ID] {
+			onlyB = append(onlyB, r.ID)
+		}
+	}
+	listSome(w, "records only in the first file", onlyA)
+	listSome(w, "records only in the second file", onlyB)
+	listSome(w, "records in a different position", moved)
+	listSome(w, "records with different indices", reindexed)
+
+	diffHash(w, "content hash", sa.content, sb.content)
+	diffHash(w, "table hash", sa.full, sb.full)
+	diffHash(w, "file hash", sa.fileHash, sb.fileHash)
+	if sa.content == sb.content && sa.fileHash != sb.fileHash {
+		fmt.Fprintf(w, "the content is identical, so the difference is entirely in the layout above\n")
+	}
+}
+
+func sameIndices(a, b []uint32) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// There can be a lot of these, so only show the first few
+func listSome(w io.Writer, what string, items []string) {
+	fmt.Fprintf(w, "%s: %d\n", what, len(items))
+	sort.Strings(items)
+	for i, item := range items {
+		if i == 10 {
+			fmt.Fprintf(w, "  ...\n")
+			break
+		}
+		fmt.Fprintf(w, "  %s\n", item)
+	}
+}
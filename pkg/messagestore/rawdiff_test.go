@@ -0,0 +1,51 @@
+package messagestore
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRawDiff(t *testing.T) {
+	a := sampleStore(t)
+	b := sampleStore(t)
+	delete(b.messages, "bye")
+	b.add("extra", "Extra", b.messages["hello"].pos)
+	dataA := encode(t, a)
+	dataB := encode(t, b)
+
+	la, err := a.ReadLayout(dataA, "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lb, err := b.ReadLayout(dataB, "b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out strings.Builder
+	RawDiff(&out, a, b, la, lb, dataA, dataB)
+	for _, want := range []string{
+		"records only in the first file: 1\n  bye\n",
+		"records only in the second file: 1\n  extra\n",
+		"unreferenced strings: 0 -> 1 (+1)",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("diff has no %q:\n%s", want, out.String())
+		}
+	}
+}
+
+func TestRawDiffSameContent(t *testing.T) {
+	a := sampleStore(t)
+	data := encode(t, a)
+	la, err := a.ReadLayout(data, "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out strings.Builder
+	RawDiff(&out, a, a, la, la, data, data)
+	for _, want := range []string{"records only in the first file: 0\n", "records in a different position: 0\n", "content hash: same"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("diff has no %q:\n%s", want, out.String())
+		}
+	}
+}
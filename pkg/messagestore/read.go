@@ -1,114 +1,137 @@
 package messagestore
 
 import (
-	"encoding/binary"
+	"bytes"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
-	"strings"
 
 	"github.com/asuffield/ouro-tools/pkg/messagestore/parse"
+	"github.com/asuffield/ouro-tools/pkg/staging"
 	"github.com/asuffield/ouro-tools/pkg/stringtable"
 )
 
+// Read reads a file or directory in any of the Formats
 func (s *Store) Read(path string) error {
-	info, err := os.Stat(path)
+	format, err := DetectFormat(path)
 	if err != nil {
 		return err
 	}
-	if info.IsDir() {
-		return s.ReadDir(path)
-	}
-
-	f, err := os.Open(path)
-	defer f.Close()
-	if err != nil {
-		return err
-	}
-
-	var signature uint32
-	err = binary.Read(f, binary.LittleEndian, &signature)
-	if err != nil {
-		return err
-	}
-	if signature == BinarySignature {
-		return s.ReadBin(f, path)
+	if len(s.inputFiles) == 0 && s.format == nil {
+		// The file which imports everything else
+		s.format = format
+		if info, err := os.Stat(path); err == nil && !info.IsDir() {
+			s.root = s.tryAbs(path)
+		}
 	}
-
-	f.Seek(0, 0)
-	return s.ReadText(f, path)
+	return format.Read(s, path)
 }
 
 func (s *Store) ReadDir(path string) error {
-	return filepath.Walk(path, func(path string, info os.FileInfo, err error) error {
+	errs := parse.ErrorList{}
+	err := filepath.Walk(path, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
 			return fmt.Errorf("failed to walk %s: %s", path, err)
 		}
-		if !info.IsDir() && !strings.HasSuffix(path, ".bak") {
+		if !info.IsDir() && !staging.IsBackup(path) {
 			f, err := os.Open(path)
 			if err != nil {
 				return fmt.Errorf("failed to open %s: %s", path, err)
 			}
-			return s.ReadText(f, path)
+			defer f.Close()
+			return collectErrors(&errs, s.ReadText(f, path))
 		}
 		return nil
 	})
+	return parseErrors(errs, err)
 }
 
+// Parse errors don't stop the rest of a tree from loading, they're
+// collected up and returned once everything else has been read
+func collectErrors(errs *parse.ErrorList, err error) error {
+	var l parse.ErrorList
+	if errors.As(err, &l) {
+		*errs = append(*errs, l...)
+		return nil
+	}
+	return err
+}
+
+func parseErrors(errs parse.ErrorList, err error) error {
+	if err != nil {
+		return err
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// Offsets in errors from ReadBin count from the start of the file,
+// including the signature which has already been read from r.
 func (s *Store) ReadBin(r io.Reader, path string) error {
-	s.readBinary = true
+	d := newDecoder(r, path, s.Limits)
+	d.salvage = s.Salvage
 
-	messageTable := &stringtable.Table{}
-	if err := messageTable.Read(r); err != nil {
-		return fmt.Errorf("failed to read messages table from %s: %s", path, err)
+	messageTable, err := d.readTable("messages")
+	if err != nil {
+		return err
 	}
+	variableTable, err := d.readTable("variable")
+	if err != nil {
+		return err
+	}
+
+	return s.readBinMessages(d, messageTable, variableTable)
+}
 
-	variableTable := &stringtable.Table{}
-	if err := variableTable.Read(r); err != nil {
-		return fmt.Errorf("failed to read variable string table from %s: %s", path, err)
+// ReadBinBytes is like ReadBin, but the string tables are decoded lazily
+// out of data, which must not be modified while the store is in use.
+func (s *Store) ReadBinBytes(data []byte, path string) error {
+	if s.Salvage {
+		// Only the streaming decoder knows how to salvage tables
+		return s.ReadBin(bytes.NewReader(data), path)
 	}
 
-	var messageCount uint32
-	if err := binary.Read(r, binary.LittleEndian, &messageCount); err != nil {
-		return fmt.Errorf("failed to read message count from %s: %s", path, err)
+	return s.readBinBytes(newDecoder(nil, path, s.Limits), data)
+}
+
+func (s *Store) readBinBytes(d *decoder, data []byte) error {
+	messageTable, n, err := d.loadTable("messages", data)
+	if err != nil {
+		return err
 	}
+	data = data[n:]
 
-	for i := uint32(0); i < messageCount; i++ {
-		var l uint32
-		if err := binary.Read(r, binary.LittleEndian, &l); err != nil {
-			return fmt.Errorf("failed to read length of string %d from %s: %s", i, path, err)
-		}
+	variableTable, n, err := d.loadTable("variable", data)
+	if err != nil {
+		return err
+	}
+	data = data[n:]
 
-		data := make([]byte, l)
-		if n, err := r.Read(data); err != nil || n != int(l) {
-			return fmt.Errorf("failed to read string %d from %s: %s", i, path, err)
-		}
-		name := string(data)
+	d.r = bytes.NewReader(data)
+	return s.readBinMessages(d, messageTable, variableTable)
+}
 
-		var index, helpIndex uint32
-		if err := binary.Read(r, binary.LittleEndian, &index); err != nil {
-			return fmt.Errorf("failed to read index of string %d from %s: %s", i, path, err)
-		}
-		if err := binary.Read(r, binary.LittleEndian, &helpIndex); err != nil {
-			return fmt.Errorf("failed to read help index of string %d from %s: %s", i, path, err)
-		}
-		msg := s.insert(name)
-		msg.index = int(index)
-		msg.helpIndex = int(helpIndex)
+func (s *Store) readBinMapped(f *os.File, path string) error {
+	data, err := mapFile(f)
+	if err != nil {
+		return fmt.Errorf("failed to map %s: %s", path, err)
+	}
+	s.mapped = append(s.mapped, data)
+	// Skip the signature, which has already been read
+	return s.ReadBinBytes(data[4:], path)
+}
 
-		var varCount uint32
-		if err := binary.Read(r, binary.LittleEndian, &varCount); err != nil {
-			return fmt.Errorf("failed to read variable count of string %d from %s: %s", i, path, err)
-		}
+func (s *Store) readBinMessages(d *decoder, messageTable, variableTable *stringtable.Table) error {
+	s.readBinary = true
 
-		for j := uint32(0); j < varCount; j++ {
-			var index uint32
-			if err := binary.Read(r, binary.LittleEndian, &index); err != nil {
-				return fmt.Errorf("failed to read variable index %s of string %d from %s: %s", j, i, path, err)
-			}
-			msg.varIndices = append(msg.varIndices, int(index))
-		}
+	err := d.readMessages(s, messageTable, variableTable)
+	s.damage = append(s.damage, d.damage...)
+	if err != nil {
+		return err
 	}
 
 	s.messageTable = messageTable
@@ -117,7 +140,7 @@ func (s *Store) ReadBin(r io.Reader, path string) error {
 	return nil
 }
 
-func (s *Store) parse(r io.Reader, path string, entrypoint string) (*parse.MessageFile, error) {
+func (s *Store) parse(r io.Reader, path string, typeFile bool) (*parse.MessageFile, error) {
 	if s.hasInputFile(path) {
 		return nil, fmt.Errorf("already read file %s", path)
 	}
@@ -126,63 +149,79 @@ func (s *Store) parse(r io.Reader, path string, entrypoint string) (*parse.Messa
 		fmt.Printf("reading %s\n", path)
 	}
 
-	res, errs := parse.ParseReader(path, r,
-		parse.Entrypoint(entrypoint),
-		parse.AllowInvalidUTF8(true))
-	if errs != nil {
-		return nil, errs
+	// Lines with errors are skipped, so there can still be a file to use
+	mf, errs := parse.ParseMessageFile(path, r, typeFile)
+	if mf != nil {
+		s.addInputFile(path, mf)
 	}
 
-	mf := res.(*parse.MessageFile)
-	s.addInputFile(path, mf)
-
-	return mf, nil
+	return mf, errs
 }
 
 func (s *Store) ReadText(r io.Reader, path string) error {
-	msgFile, err := s.parse(r, path, "MessageFile")
-	if err != nil {
+	errs := parse.ErrorList{}
+	msgFile, err := s.parse(r, path, false)
+	if msgFile == nil {
 		return err
 	}
+	collectErrors(&errs, err)
+
 	for _, line := range msgFile.Lines {
 		if imp, ok := line.(*parse.Import); ok {
 			evalName := func(n string) string {
 				return filepath.Join(filepath.Dir(path), n)
 			}
-			if err := s.Read(evalName(imp.MessageFile)); err != nil {
+			if err := collectErrors(&errs, s.Read(evalName(imp.MessageFile))); err != nil {
 				return err
 			}
 			if imp.TypeFile != "" {
-				if err := s.ReadType(evalName(imp.TypeFile)); err != nil {
+				if err := collectErrors(&errs, s.ReadType(evalName(imp.TypeFile))); err != nil {
 					return err
 				}
 			}
 		}
 
 		for _, m := range line.Messages() {
-			if s.find(m.Id) != nil {
-				// Ignore duplicates, take the first definition (that's how the format works)
-				continue
-			}
-			msg := s.insert(m.Id)
-			i := s.messageTable.Add(m.Content)
-			if s.useHelpIndex {
-				msg.helpIndex = i
-			} else {
-				msg.index = i
-			}
+			s.add(m.Id, m.Content, line.Pos())
 		}
 		//fmt.Print(line.Format())
 	}
-	return nil
+	return parseErrors(errs, nil)
+}
+
+// add a message, unless there already is one with the same id. Returns
+// the new message, or nil for a duplicate.
+func (s *Store) add(id, content string, pos parse.Position) *Message {
+	if s.find(id) != nil {
+		// Ignore duplicates, take the first definition (that's how the format works)
+		return nil
+	}
+	msg := s.insert(id)
+	msg.pos = pos
+	i := s.messageTable.Add(content)
+	if s.useHelpIndex {
+		msg.helpIndex = i
+	} else {
+		msg.index = i
+	}
+	return msg
+}
+
+// addVars gives msg more variables
+func (s *Store) addVars(msg *Message, vars []parse.Var) {
+	for _, v := range vars {
+		i := s.variableTable.Add(v.Name)
+		s.variableTable.Add(v.Ty)
+		msg.varIndices = append(msg.varIndices, i)
+	}
 }
 
 func (s *Store) ReadType(path string) error {
 	f, err := os.Open(path)
 	defer f.Close()
 
-	msgFile, err := s.parse(f, path, "MessageTypeFile")
-	if err != nil {
+	msgFile, err := s.parse(f, path, true)
+	if msgFile == nil {
 		return err
 	}
 
@@ -199,7 +238,7 @@ func (s *Store) ReadType(path string) error {
 				indices = append(indices, i)
 			}
 			// Each type entry is applied to all four instances of the message
-			for _, prefix := range []string{"", "v_", "p_", "l_"} {
+			for _, prefix := range typePrefixes {
 				id := prefix + t.Id
 				if msg := s.find(id); msg != nil {
 					msg.varIndices = append(msg.varIndices, indices...)
@@ -209,5 +248,5 @@ func (s *Store) ReadType(path string) error {
 		//fmt.Print(line.Format())
 	}
 
-	return nil
+	return err
 }
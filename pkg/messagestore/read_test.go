@@ -0,0 +1,42 @@
+package messagestore
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/asuffield/ouro-tools/pkg/messagestore/parse"
+)
+
+// Every bad line in the tree is reported, with where it is
+func TestReadParseErrors(t *testing.T) {
+	dir := makeTree(t, map[string]string{
+		"main.txt":  "\"a\" \"A\"\n  junk here\n\"b\" \"B\"\n\"c\" oops\nimport sub.txt types.txt\n",
+		"sub.txt":   "\"x\" \"X\"\n\n   bad\n",
+		"types.txt": "",
+	})
+	err := NewStore().Read(filepath.Join(dir, "main.txt"))
+
+	var list parse.ErrorList
+	if !errors.As(err, &list) {
+		t.Fatalf("got %v, want an ErrorList", err)
+	}
+	want := []parse.Position{
+		{File: filepath.Join(dir, "main.txt"), Line: 2, Col: 1, Offset: 8},
+		{File: filepath.Join(dir, "main.txt"), Line: 4, Col: 1, Offset: 28},
+		{File: filepath.Join(dir, "sub.txt"), Line: 3, Col: 1, Offset: 9},
+	}
+	if len(list) != len(want) {
+		t.Fatalf("got %d errors, want %d:\n%s", len(list), len(want), err)
+	}
+	for i, pe := range list {
+		if pe.Position != want[i] {
+			t.Errorf("error %d is at %+v, want %+v", i, pe.Position, want[i])
+		}
+	}
+
+	var pe *parse.ParseError
+	if !errors.As(err, &pe) || pe.Line != 2 {
+		t.Errorf("errors.As found %v, want the first error", pe)
+	}
+}
@@ -0,0 +1,188 @@
+package messagestore
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/asuffield/ouro-tools/pkg/messagestore/parse"
+)
+
+// Route sends messages with ids matching Match into File, relative to
+// the base of the tree, when they aren't in the template
+type Route struct {
+	Match *regexp.Regexp
+	File  string
+}
+
+func (s *Store) route(id string) string {
+	for _, r := range s.Routes {
+		if r.Match.MatchString(id) {
+			return filepath.Clean(r.File)
+		}
+	}
+	return ""
+}
+
+// routeMissing adds the messages which have a route, and their types, to
+// the files to be written. Files which aren't in the template are
+// created, along with a types file if needed, and imported from the root
+// of the template. A types file is also created for a template file
+// which is imported without one. Returns whatever is left over.
+func (s *Store) routeMissing(template *Store, files map[string]*parse.MessageFile, messages []parse.Message, types []parse.Type) ([]parse.Message, []parse.Type, error) {
+	routed := map[string][]parse.Message{}
+	names := []string{}
+	leftMessages := []parse.Message{}
+	for _, m := range messages {
+		name := s.route(m.Id)
+		if name == "" {
+			leftMessages = append(leftMessages, m)
+			continue
+		}
+		if routed[name] == nil {
+			names = append(names, name)
+		}
+		routed[name] = append(routed[name], m)
+	}
+	sort.Strings(names)
+
+	typesByID := map[string]parse.Type{}
+	for _, t := range types {
+		typesByID[strings.ToLower(t.Id)] = t
+	}
+
+	// Template files are copied before they are changed
+	edit := func(name string) *parse.MessageFile {
+		f := files[name]
+		if f == template.inputFiles[name] {
+			f = &parse.MessageFile{Lines: append([]parse.Line{}, f.Lines...), TypeFile: f.TypeFile, BOM: f.BOM}
+			files[name] = f
+		}
+		return f
+	}
+
+	for _, name := range names {
+		entries := []parse.Line{}
+		typeEntries := []parse.Line{}
+		typed := []string{}
+		for _, m := range routed[name] {
+			// The content is filled in when the file is written
+			entry, _ := parse.NewMessageEntry(m.Id, "", false)
+			entries = append(entries, entry)
+			if t, ok := typesByID[strings.ToLower(m.Id)]; ok {
+				typeEntries = append(typeEntries, newTypeEntry(t))
+				typed = append(typed, strings.ToLower(m.Id))
+			}
+		}
+
+		if files[name] != nil {
+			edit(name).Append(entries...)
+			if len(typeEntries) == 0 {
+				continue
+			}
+
+			importer, imp := template.importOf(name)
+			if imp == nil {
+				return nil, nil, fmt.Errorf("can't route the types of %s into %s, it isn't imported anywhere to give it a types file", strings.Join(typed, ", "), name)
+			}
+			typeName := filepath.Join(filepath.Dir(importer), imp.TypeFile)
+			if imp.TypeFile == "" {
+				typeName = routedTypesName(name)
+				if files[typeName] != nil {
+					return nil, nil, fmt.Errorf("can't create %s for the types of %s, it already exists", typeName, name)
+				}
+				// The import is replaced rather than changed, since the
+				// template still has it
+				withTypes := *imp
+				withTypes.TypeFile = relativeTo(importer, typeName)
+				edit(importer).Rewrite(func(l parse.Line) []parse.Line {
+					if l == imp {
+						return []parse.Line{&withTypes}
+					}
+					return []parse.Line{l}
+				})
+			}
+			if files[typeName] == nil {
+				files[typeName] = parse.NewMessageFile(true)
+			}
+			edit(typeName).Append(typeEntries...)
+			for _, id := range typed {
+				delete(typesByID, id)
+			}
+			continue
+		}
+
+		files[name] = parse.NewMessageFile(false, append([]parse.Line{parse.NewComment("// Generated by ouro-tools")}, entries...)...)
+		typeName := ""
+		if len(typeEntries) > 0 {
+			typeName = routedTypesName(name)
+			files[typeName] = parse.NewMessageFile(true, typeEntries...)
+			for _, id := range typed {
+				delete(typesByID, id)
+			}
+		}
+
+		// A template read from a directory has no root, but then every
+		// file in the directory is read anyway
+		if template.root != "" && files[template.root] != nil {
+			edit(template.root).Append(parse.NewImport(relativeTo(template.root, name), relativeTo(template.root, typeName)))
+		}
+	}
+
+	leftTypes := []parse.Type{}
+	for _, t := range types {
+		if _, ok := typesByID[strings.ToLower(t.Id)]; ok {
+			leftTypes = append(leftTypes, t)
+		}
+	}
+	return leftMessages, leftTypes, nil
+}
+
+// routedTypesName is the types file created for a routed file
+func routedTypesName(name string) string {
+	return strings.TrimSuffix(name, filepath.Ext(name)) + "-types" + filepath.Ext(name)
+}
+
+func newTypeEntry(t parse.Type) *parse.TypeEntry {
+	vars := []*parse.VarType{}
+	for _, v := range t.Vars {
+		vars = append(vars, parse.NewVarType(v.Name, v.Ty))
+	}
+	return parse.NewTypeEntry(t.Id, vars...)
+}
+
+// importOf finds the import of a messages file, and the file it's in.
+// An import which has a types file is preferred.
+func (s *Store) importOf(name string) (string, *parse.Import) {
+	importers := []string{}
+	for importer := range s.inputFiles {
+		importers = append(importers, importer)
+	}
+	sort.Strings(importers)
+
+	var found *parse.Import
+	foundIn := ""
+	for _, importer := range importers {
+		s.inputFiles[importer].Walk(func(line parse.Line) {
+			imp, ok := line.(*parse.Import)
+			if ok && filepath.Join(filepath.Dir(importer), imp.MessageFile) == name && (found == nil || found.TypeFile == "") {
+				found, foundIn = imp, importer
+			}
+		})
+	}
+	return foundIn, found
+}
+
+// Imports are relative to the directory of the importing file
+func relativeTo(importer, name string) string {
+	if name == "" {
+		return ""
+	}
+	rel, err := filepath.Rel(filepath.Dir(importer), name)
+	if err != nil {
+		return name
+	}
+	return filepath.ToSlash(rel)
+}
@@ -0,0 +1,101 @@
+package messagestore
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/asuffield/ouro-tools/pkg/messagestore/parse"
+)
+
+var routeTree = map[string]string{
+	"main.txt": "import a.txt a-t.txt\nimport b.txt\n",
+	"a.txt":    "\"a_old\" \"A {n}\"\n",
+	"a-t.txt":  "\"a_old\" {n,int}\n",
+	"b.txt":    "\"b_old\" \"B\"\n",
+}
+
+func routeStore(t *testing.T, tree map[string]string) *Store {
+	t.Helper()
+	s := readStore(t, filepath.Join(makeTree(t, tree), "main.txt"))
+	for id, v := range map[string]string{"a_new": "x", "b_new": "y", "c_new": "z"} {
+		msg := s.add(id, "{"+v+"}", parse.Position{})
+		s.addVars(msg, []parse.Var{{Name: v, Ty: "int"}})
+	}
+	s.add("other", "Other", parse.Position{})
+	s.Routes = []Route{
+		{Match: regexp.MustCompile("^a_"), File: "a.txt"},
+		{Match: regexp.MustCompile("^b_"), File: "b.txt"},
+		{Match: regexp.MustCompile("^c_"), File: "c/new.txt"},
+	}
+	return s
+}
+
+// Routed messages go into their files, and their types into the types
+// file imported with them, which is created if there isn't one
+func TestRouteMissing(t *testing.T) {
+	s := routeStore(t, routeTree)
+	template := readStore(t, filepath.Join(makeTree(t, routeTree), "main.txt"))
+	out := filepath.Join(t.TempDir(), "main.txt")
+	if err := s.Write(out, template); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]string{
+		"main.txt":        "import a.txt a-t.txt\nimport b.txt b-types.txt\nimport c/new.txt c/new-types.txt\r\n",
+		"a.txt":           "\"a_old\" \"A {n}\"\n\"a_new\" \"{x}\"\r\n",
+		"a-t.txt":         "\"a_old\" {n,int}\n\"a_new\" {x,int}\r\n",
+		"b.txt":           "\"b_old\" \"B\"\n\"b_new\" \"{y}\"\r\n",
+		"b-types.txt":     "\"b_new\" {y,int}\r\n",
+		"c/new.txt":       "\uFEFF// Generated by ouro-tools\r\n\"c_new\" \"{z}\"\r\n",
+		"c/new-types.txt": "\"c_new\" {z,int}\r\n",
+	}
+	for name, content := range want {
+		got, err := os.ReadFile(filepath.Join(filepath.Dir(out), name))
+		if err != nil {
+			t.Error(err)
+		} else if string(got) != content {
+			t.Errorf("%s is %q, want %q", name, got, content)
+		}
+	}
+
+	// Only the unrouted message is left over, and no types are lost
+	missing, err := os.ReadFile(filepath.Join(filepath.Dir(out), "missing-data.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(missing), "TYPE") || !strings.Contains(string(missing), "\"other\" \"Other\"") || strings.Contains(string(missing), "_new") {
+		t.Errorf("missing-data.txt is %q", missing)
+	}
+	written := readStore(t, out)
+	for _, id := range []string{"a_new", "b_new", "c_new"} {
+		if got, want := formatVars(written.MessageVars(id)), formatVars(s.MessageVars(id)); got != want {
+			t.Errorf("%s has %s, want %s", id, got, want)
+		}
+	}
+
+	// The template is as it was
+	if got := template.inputFiles["main.txt"].Format(); got != routeTree["main.txt"] {
+		t.Errorf("template main.txt is now %q", got)
+	}
+}
+
+// A file which isn't imported anywhere can't be given a types file
+func TestRouteMissingNoImport(t *testing.T) {
+	tree := map[string]string{
+		"main.txt": "\"main\" \"Main\"\n",
+		"a.txt":    "\"a_old\" \"A\"\n",
+	}
+	s := routeStore(t, tree)
+	template := NewStore()
+	template.BaseDir = makeTree(t, tree)
+	if err := template.Read(template.BaseDir); err != nil {
+		t.Fatal(err)
+	}
+	out := filepath.Join(t.TempDir(), "main.txt")
+	if err := s.Write(out, template); err == nil || !strings.Contains(err.Error(), "a.txt") {
+		t.Errorf("got %v, want an error about a.txt", err)
+	}
+}
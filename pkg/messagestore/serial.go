@@ -0,0 +1,123 @@
+package messagestore
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/asuffield/ouro-tools/pkg/messagestore/parse"
+	"github.com/asuffield/ouro-tools/pkg/staging"
+)
+
+// JSON and YAML hold a whole store, for tools in other languages. Maps
+// are written sorted, so the files are stable and diff well.
+type serialFormat struct {
+	name       string
+	extensions []string
+	marshal    func(interface{}) ([]byte, error)
+	unmarshal  func([]byte, interface{}) error
+}
+
+func init() {
+	RegisterFormat(serialFormat{"json", []string{".json"}, marshalJSON, json.Unmarshal})
+	RegisterFormat(serialFormat{"yaml", []string{".yaml", ".yml"}, yaml.Marshal, yaml.Unmarshal})
+}
+
+func marshalJSON(v interface{}) ([]byte, error) {
+	data, err := json.MarshalIndent(v, "", "  ")
+	return append(data, '\n'), err
+}
+
+type storeDoc struct {
+	Messages map[string]*messageDoc `json:"messages" yaml:"messages"`
+}
+
+type messageDoc struct {
+	Text string   `json:"text" yaml:"text"`
+	Help *string  `json:"help,omitempty" yaml:"help,omitempty"`
+	Vars []varDoc `json:"vars,omitempty" yaml:"vars,omitempty"`
+	// Where the message was defined, with Store.Provenance
+	Source string `json:"source,omitempty" yaml:"source,omitempty"`
+}
+
+type varDoc struct {
+	Name string `json:"name" yaml:"name"`
+	Type string `json:"type" yaml:"type"`
+}
+
+func (f serialFormat) Name() string {
+	return f.name
+}
+
+func (f serialFormat) Detect(path string, head []byte) bool {
+	for _, ext := range f.extensions {
+		if strings.HasSuffix(path, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+func (f serialFormat) Write(p *staging.Plan, s *Store, path string, template *Store) error {
+	doc := storeDoc{Messages: map[string]*messageDoc{}}
+	for _, id := range s.MessageIDs() {
+		m := &messageDoc{Text: s.Message(id)}
+		if help, ok := s.MessageHelp(id); ok {
+			m.Help = &help
+		}
+		for _, v := range s.MessageVars(id) {
+			m.Vars = append(m.Vars, varDoc{v.Name, v.Ty})
+		}
+		if pos, ok := s.MessageDefinition(id); ok && s.Provenance {
+			m.Source = fmt.Sprintf("%s:%d", pos.File, pos.Line)
+		}
+		doc.Messages[id] = m
+	}
+
+	data, err := f.marshal(doc)
+	if err != nil {
+		return fmt.Errorf("failed to encode %s: %s", path, err)
+	}
+	return p.Add(path, data, len(doc.Messages))
+}
+
+func (f serialFormat) Read(s *Store, path string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	doc := storeDoc{}
+	if err := f.unmarshal(data, &doc); err != nil {
+		return fmt.Errorf("failed to decode %s: %s", path, err)
+	}
+
+	ids := []string{}
+	for id := range doc.Messages {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		m := doc.Messages[id]
+		if m == nil {
+			return fmt.Errorf("failed to decode %s: message %s is empty", path, id)
+		}
+		msg := s.add(id, m.Text, parse.Position{})
+		if msg == nil {
+			return fmt.Errorf("failed to decode %s: duplicate message %s", path, id)
+		}
+		if m.Help != nil {
+			msg.helpIndex = s.messageTable.FindOrAdd(*m.Help)
+			msg.hasHelp = true
+		}
+		vars := []parse.Var{}
+		for _, v := range m.Vars {
+			vars = append(vars, parse.Var{Name: v.Name, Ty: v.Type})
+		}
+		s.addVars(msg, vars)
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+package messagestore
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSerialRoundTrip(t *testing.T) {
+	s := trickyStore(t)
+	for _, name := range []string{"out.json", "out.yaml", "out.yml"} {
+		sameContent(t, s, writeAndRead(t, s, name, nil))
+	}
+}
+
+// The same store is always written the same way, whatever order it was
+// read in
+func TestSerialStable(t *testing.T) {
+	for _, name := range []string{"out.json", "out.yaml"} {
+		s := trickyStore(t)
+		again := writeAndRead(t, s, name, nil)
+
+		var outputs [][]byte
+		for _, store := range []*Store{s, again} {
+			path := filepath.Join(t.TempDir(), name)
+			if err := store.Write(path, nil); err != nil {
+				t.Fatal(err)
+			}
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			outputs = append(outputs, data)
+		}
+		if !bytes.Equal(outputs[0], outputs[1]) {
+			t.Errorf("%s: wrote\n%s\nthen\n%s", name, outputs[0], outputs[1])
+		}
+		if i, j := bytes.Index(outputs[0], []byte("bye")), bytes.Index(outputs[0], []byte("hello")); i < 0 || j < i {
+			t.Errorf("%s: messages aren't sorted:\n%s", name, outputs[0])
+		}
+	}
+}
+
+// Ids only differing in case are the same message
+func TestSerialDuplicate(t *testing.T) {
+	dir := makeTree(t, map[string]string{
+		"in.json": `{"messages": {"Hello": {"text": "a"}, "hello": {"text": "b"}}}`,
+	})
+	err := NewStore().Read(filepath.Join(dir, "in.json"))
+	if err == nil || !strings.Contains(err.Error(), "duplicate message hello") {
+		t.Errorf("got %v, want a duplicate message", err)
+	}
+}
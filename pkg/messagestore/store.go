@@ -17,6 +17,19 @@ const BinarySignature = 20090521
 type Store struct {
 	Verbose bool
 	BaseDir string
+	// Lazy stores map binary files into memory and decode strings on
+	// demand, which suits read-only use. Call Close when done.
+	Lazy bool
+	// Limits applied when decoding binary files
+	Limits Limits
+	// Salvage whatever can be read out of damaged binary files, instead
+	// of failing. See Damage for what was lost.
+	Salvage bool
+	// Where to put messages which aren't in the template when writing
+	// text, instead of missing-data.txt
+	Routes []Route
+	// Include where each message was defined, in formats which can
+	Provenance bool
 
 	readBinary    bool
 	useHelpIndex  bool
@@ -24,17 +37,29 @@ type Store struct {
 	variableTable *stringtable.Table
 	messages      map[string]*Message
 	inputFiles    map[string]*parse.MessageFile
+	root          string
+	format        Format
+	mapped        [][]byte
+	damage        []Damage
 }
 
+// A type entry applies to the message with its own id, and to those
+// with each of these prefixes
+var typePrefixes = []string{"", "v_", "p_", "l_"}
+
 type Message struct {
 	id         string
 	index      int
 	helpIndex  int
+	hasHelp    bool
 	varIndices []int
+	// Where the message was defined, for messages read from text
+	pos parse.Position
 }
 
 func NewStore() *Store {
 	return &Store{
+		Limits:        DefaultLimits,
 		messageTable:  stringtable.New(),
 		variableTable: stringtable.New(),
 		inputFiles:    map[string]*parse.MessageFile{},
@@ -42,6 +67,28 @@ func NewStore() *Store {
 	}
 }
 
+// Close releases any files mapped by a lazy store. The store must not be
+// used afterwards.
+func (s *Store) Close() error {
+	for _, data := range s.mapped {
+		if err := unmapFile(data); err != nil {
+			return err
+		}
+	}
+	s.mapped = nil
+	return nil
+}
+
+// Binary is whether the store was read from a binary file
+func (s *Store) Binary() bool {
+	return s.readBinary
+}
+
+// Damage describes what was lost from damaged files read in salvage mode
+func (s *Store) Damage() []Damage {
+	return s.damage
+}
+
 func (s *Store) Hash(w io.Writer, contentOnly bool) {
 	if !contentOnly {
 		s.messageTable.Hash(w, false)
@@ -102,6 +149,15 @@ func (s *Store) Message(id string) string {
 	}
 }
 
+// MessageHelp is the help text of a message. Only binary files have it.
+func (s *Store) MessageHelp(id string) (string, bool) {
+	msg := s.find(id)
+	if msg == nil || !msg.hasHelp {
+		return "", false
+	}
+	return s.messageTable.Get(msg.helpIndex), true
+}
+
 func (s *Store) MessageVarTypes(id string) map[string]string {
 	types := map[string]string{}
 	msg := s.messages[strings.ToLower(id)]
@@ -115,6 +171,27 @@ func (s *Store) MessageVarTypes(id string) map[string]string {
 	return types
 }
 
+// MessageVars is like MessageVarTypes, but in the order they are stored
+func (s *Store) MessageVars(id string) []parse.Var {
+	vars := []parse.Var{}
+	if msg := s.find(id); msg != nil {
+		for _, index := range msg.varIndices {
+			vars = append(vars, parse.Var{Name: s.variableTable.Get(index), Ty: s.variableTable.Get(index + 1)})
+		}
+	}
+	return vars
+}
+
+// MessageDefinition gives where the message which is in use was defined,
+// if it came from a text file
+func (s *Store) MessageDefinition(id string) (parse.Position, bool) {
+	msg := s.find(id)
+	if msg == nil || msg.pos.Line == 0 {
+		return parse.Position{}, false
+	}
+	return msg.pos, true
+}
+
 func (s *Store) tryAbs(path string) string {
 	// Make abs, if possible
 	a, err := filepath.Abs(path)
@@ -0,0 +1,64 @@
+package messagestore
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+)
+
+// Encoder writes stores to a stream in the binary format, signature and
+// all
+type Encoder struct {
+	w io.Writer
+	// Name of the stream, for errors
+	Name string
+}
+
+func NewEncoder(w io.Writer) *Encoder {
+	return &Encoder{w: w, Name: "output"}
+}
+
+func (e *Encoder) Encode(s *Store) error {
+	w := bufio.NewWriter(e.w)
+	if err := s.writeBin(w, e.Name); err != nil {
+		return err
+	}
+	return w.Flush()
+}
+
+// Decoder reads stores from a stream in the binary format, checking the
+// signature itself
+type Decoder struct {
+	r io.Reader
+	// Name of the stream, for errors
+	Name string
+}
+
+func NewDecoder(r io.Reader) *Decoder {
+	return &Decoder{r: r, Name: "input"}
+}
+
+// Decode reads into s, so that its settings such as Limits and Salvage
+// apply
+func (d *Decoder) Decode(s *Store) error {
+	var signature uint32
+	if err := binary.Read(d.r, binary.LittleEndian, &signature); err != nil {
+		return decodeError(d.Name, 0, err, "failed to read signature")
+	}
+	if signature != BinarySignature {
+		return decodeError(d.Name, 0, ErrBadSignature, "signature is %d, expected %d", signature, BinarySignature)
+	}
+	return s.ReadBin(d.r, d.Name)
+}
+
+// ReadStream reads either format from r. Text read this way has nowhere
+// to import other files from but the current directory.
+func (s *Store) ReadStream(r io.Reader, name string) error {
+	br := bufio.NewReader(r)
+	if sig, err := br.Peek(4); err == nil && binary.LittleEndian.Uint32(sig) == BinarySignature {
+		d := NewDecoder(br)
+		d.Name = name
+		return d.Decode(s)
+	}
+	return s.ReadText(br, name)
+}
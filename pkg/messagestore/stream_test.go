@@ -0,0 +1,79 @@
+package messagestore
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestEncodeDecode(t *testing.T) {
+	s := trickyStore(t)
+	var b bytes.Buffer
+	if err := NewEncoder(&b).Encode(s); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(b.Bytes(), u32s(BinarySignature)) {
+		t.Errorf("no signature at the start of %q", b.Bytes())
+	}
+
+	got := NewStore()
+	if err := NewDecoder(&b).Decode(got); err != nil {
+		t.Fatal(err)
+	}
+	sameContent(t, s, got)
+}
+
+// Errors are about the stream by its name, with the offset in it
+func TestDecodeErrors(t *testing.T) {
+	data := encode(t, sampleStore(t))
+	for name, tc := range map[string]struct {
+		data   []byte
+		want   error
+		offset int64
+	}{
+		"signature": {u32s(12345), ErrBadSignature, 0},
+		"empty":     {nil, ErrTruncated, 0},
+		"short":     {data[:2], ErrTruncated, 0},
+		"truncated": {data[:len(data)-1], ErrTruncated, -1},
+	} {
+		d := NewDecoder(bytes.NewReader(tc.data))
+		d.Name = "stream.bin"
+		err := d.Decode(NewStore())
+		var de *DecodeError
+		if !errors.Is(err, tc.want) || !errors.As(err, &de) {
+			t.Errorf("%s: got %v, want %v", name, err, tc.want)
+			continue
+		}
+		if de.Path != "stream.bin" || tc.offset >= 0 && de.Offset != tc.offset {
+			t.Errorf("%s: error is at offset %d in %s", name, de.Offset, de.Path)
+		}
+	}
+}
+
+// ReadStream tells the formats apart by the signature
+func TestReadStream(t *testing.T) {
+	s := sampleStore(t)
+	bin := NewStore()
+	if err := bin.ReadStream(bytes.NewReader(encode(t, s)), "-"); err != nil {
+		t.Fatal(err)
+	}
+	if !bin.Binary() {
+		t.Errorf("binary stream wasn't read as binary")
+	}
+	sameContent(t, s, bin)
+
+	text := NewStore()
+	if err := text.ReadStream(strings.NewReader("\"hello\" \"Hello\"\n\"bye\" <<Bye>>\n"), "-"); err != nil {
+		t.Fatal(err)
+	}
+	if text.Binary() || text.Message("hello") != "Hello" || text.Message("bye") != "Bye" {
+		t.Errorf("text stream read as %v", text.MessageIDs())
+	}
+
+	// Too short to have a signature, so it can only be text
+	short := NewStore()
+	if err := short.ReadStream(strings.NewReader("\n"), "-"); err != nil || len(short.MessageIDs()) != 0 {
+		t.Errorf("got %v and %v", short.MessageIDs(), err)
+	}
+}
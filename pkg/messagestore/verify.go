@@ -0,0 +1,187 @@
+package messagestore
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// Mismatch is a file which doesn't write back out exactly as it was read
+type Mismatch struct {
+	Path      string
+	Line      int
+	Want, Got string
+}
+
+func (m Mismatch) String() string {
+	return fmt.Sprintf("%s:%d: read %q, would write %q", m.Path, m.Line, m.Want, m.Got)
+}
+
+// CheckLossless writes every text file read into the store back out,
+// using the store as its own template, and reports each file which
+// doesn't come out identical to what is on disk
+func (s *Store) CheckLossless() ([]Mismatch, error) {
+	names := []string{}
+	for name := range s.inputFiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	mismatches := []Mismatch{}
+	for _, name := range names {
+		path := filepath.Join(s.BaseDir, name)
+		want, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %s", path, err)
+		}
+		text, err := s.inputFiles[name].FormatWith(s)
+		if err != nil {
+			return nil, err
+		}
+		got := []byte(text)
+		if !bytes.Equal(want, got) {
+			mismatches = append(mismatches, firstMismatch(path, want, got))
+		}
+	}
+	return mismatches, nil
+}
+
+func firstMismatch(path string, want, got []byte) Mismatch {
+	i := 0
+	for i < len(want) && i < len(got) && want[i] == got[i] {
+		i++
+	}
+	start := bytes.LastIndexByte(want[:i], '\n') + 1
+	return Mismatch{
+		Path: path,
+		Line: bytes.Count(want[:start], []byte{'\n'}) + 1,
+		Want: string(lineAt(want, start)),
+		Got:  string(lineAt(got, start)),
+	}
+}
+
+// The line starting at start, including its ending
+func lineAt(data []byte, start int) []byte {
+	if start >= len(data) {
+		return nil
+	}
+	data = data[start:]
+	if n := bytes.IndexByte(data, '\n'); n >= 0 {
+		return data[:n+1]
+	}
+	return data
+}
+
+// ContentHash is a hash of the messages and their types, which doesn't
+// depend on how they are stored
+func (s *Store) ContentHash() string {
+	h := sha256.New()
+	s.Hash(h, true)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Stage is the store as read back at one step of RoundTrip
+type Stage struct {
+	Name  string
+	Store *Store
+}
+
+// RoundTrip converts a store read from the text tree at root into
+// binary, and back into text with the original tree as the template,
+// reading each result back in. The first stage is s itself.
+func (s *Store) RoundTrip(root string) ([]Stage, error) {
+	stages := []Stage{{"text", s}}
+
+	var buf bytes.Buffer
+	e := NewEncoder(&buf)
+	e.Name = "memory"
+	if err := e.Encode(s); err != nil {
+		return stages, err
+	}
+	bin := s.newStage()
+	d := NewDecoder(&buf)
+	d.Name = "memory"
+	if err := d.Decode(bin); err != nil {
+		return stages, err
+	}
+	stages = append(stages, Stage{"binary", bin})
+
+	dir, err := ioutil.TempDir("", "messagestore")
+	if err != nil {
+		return stages, fmt.Errorf("failed to create temporary directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err := bin.WriteText(dir, s); err != nil {
+		return stages, err
+	}
+	text := s.newStage()
+	text.BaseDir = dir
+	if err := text.Read(filepath.Join(dir, s.tryAbs(root))); err != nil {
+		return stages, err
+	}
+	stages = append(stages, Stage{"text from binary", text})
+
+	return stages, nil
+}
+
+func (s *Store) newStage() *Store {
+	stage := NewStore()
+	stage.Limits = s.Limits
+	return stage
+}
+
+// Change is a message which is different in two stores
+type Change struct {
+	ID            string
+	What          string
+	Before, After string
+}
+
+func (c Change) String() string {
+	return fmt.Sprintf("%s: %s changed from %q to %q", c.ID, c.What, c.Before, c.After)
+}
+
+// Changes lists how the messages in other differ from those in s
+func (s *Store) Changes(other *Store) []Change {
+	ids := map[string]bool{}
+	for _, id := range s.MessageIDs() {
+		ids[id] = true
+	}
+	for _, id := range other.MessageIDs() {
+		ids[id] = true
+	}
+	sorted := []string{}
+	for id := range ids {
+		sorted = append(sorted, id)
+	}
+	sort.Strings(sorted)
+
+	changes := []Change{}
+	for _, id := range sorted {
+		if s.HasMessage(id) != other.HasMessage(id) {
+			changes = append(changes, Change{id, "presence", presence(s, id), presence(other, id)})
+			continue
+		}
+		if a, b := s.Message(id), other.Message(id); a != b {
+			changes = append(changes, Change{id, "text", a, b})
+		}
+		// In order and with any repeats, since that's what is stored
+		if a, b := formatVars(s.MessageVars(id)), formatVars(other.MessageVars(id)); a != b {
+			changes = append(changes, Change{id, "types", a, b})
+		}
+	}
+	return changes
+}
+
+func presence(s *Store, id string) string {
+	if s.HasMessage(id) {
+		return "present"
+	}
+	return "missing"
+}
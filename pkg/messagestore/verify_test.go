@@ -0,0 +1,50 @@
+package messagestore
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestRoundTrip(t *testing.T) {
+	root := filepath.Join(makeTree(t, sampleTree), "main.txt")
+	s := readStore(t, root)
+
+	mismatches, err := s.CheckLossless()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, m := range mismatches {
+		t.Errorf("%s", m)
+	}
+
+	stages, err := s.RoundTrip(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stages) != 3 {
+		t.Fatalf("got %d stages, want 3", len(stages))
+	}
+	for _, stage := range stages {
+		sameContent(t, s, stage.Store)
+	}
+}
+
+// Changes sees the order of variables, and repeats, not just their types
+func TestChangesVarOrder(t *testing.T) {
+	a := sampleStore(t)
+	b := sampleStore(t)
+	vars := b.messages["count"].varIndices
+	vars[0], vars[1] = vars[1], vars[0]
+	b.messages["hello"].varIndices = append(b.messages["hello"].varIndices, b.messages["hello"].varIndices...)
+
+	changes := a.Changes(b)
+	if len(changes) != 2 || changes[0].ID != "count" || changes[1].ID != "hello" {
+		t.Fatalf("changes are %v, want count and hello", changes)
+	}
+	if changes[1].After != "{name,string} {name,string}" {
+		t.Errorf("hello changed to %q", changes[1].After)
+	}
+	if a.ContentHash() == b.ContentHash() {
+		t.Errorf("content hash didn't change")
+	}
+}
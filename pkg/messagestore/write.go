@@ -1,6 +1,7 @@
 package messagestore
 
 import (
+	"bytes"
 	"encoding/binary"
 	"fmt"
 	"io"
@@ -10,22 +11,22 @@ import (
 	"strings"
 
 	"github.com/asuffield/ouro-tools/pkg/messagestore/parse"
+	"github.com/asuffield/ouro-tools/pkg/staging"
 )
 
 func (s *Store) Write(path string, template *Store) error {
-	if template != nil {
-		if template.readBinary {
-			return s.WriteBin(path, template)
-		} else {
-			return s.WriteText(path, template)
-		}
+	p, err := s.PlanWrite(path, template)
+	if err != nil {
+		return err
 	}
+	return p.Commit()
+}
 
-	if strings.HasSuffix(path, ".bin") {
-		return s.WriteBin(path, nil)
-	} else {
-		return s.WriteText(path, nil)
-	}
+// PlanWrite works out what Write would do, without writing anything. The
+// format comes from OutputFormat.
+func (s *Store) PlanWrite(path string, template *Store) (*staging.Plan, error) {
+	p := staging.NewPlan()
+	return p, OutputFormat(path, template).Write(p, s, path, template)
 }
 
 func writeU32(w io.Writer, i int) error {
@@ -34,12 +35,22 @@ func writeU32(w io.Writer, i int) error {
 }
 
 func (s *Store) WriteBin(path string, template *Store) error {
-	f, err := os.Create(path)
-	defer f.Close()
-	if err != nil {
+	p := staging.NewPlan()
+	if err := s.planBin(p, path); err != nil {
 		return err
 	}
+	return p.Commit()
+}
 
+func (s *Store) planBin(p *staging.Plan, path string) error {
+	var buf bytes.Buffer
+	if err := s.writeBin(&buf, path); err != nil {
+		return err
+	}
+	return p.Add(path, buf.Bytes(), len(s.messages))
+}
+
+func (s *Store) writeBin(f io.Writer, path string) error {
 	if err := writeU32(f, BinarySignature); err != nil {
 		return fmt.Errorf("failed to write message count to %s: %s", path, err)
 	}
@@ -56,11 +67,19 @@ func (s *Store) WriteBin(path string, template *Store) error {
 		return fmt.Errorf("failed to write message count to %s: %s", path, err)
 	}
 
-	for name, msg := range s.messages {
+	// In a fixed order, so that unchanged stores write identical files
+	names := []string{}
+	for name := range s.messages {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		msg := s.messages[name]
 		if err := writeU32(f, len(msg.id)); err != nil {
 			return fmt.Errorf("failed to write length of string %s to %s: %s", name, path, err)
 		}
-		if _, err := f.WriteString(msg.id); err != nil {
+		if _, err := io.WriteString(f, msg.id); err != nil {
 			return fmt.Errorf("failed to write string %s to %s: %s", name, path, err)
 		}
 		if err := writeU32(f, msg.index); err != nil {
@@ -83,31 +102,39 @@ func (s *Store) WriteBin(path string, template *Store) error {
 }
 
 // Find all the things in s which are not in template
-func (s *Store) missingIds(template *Store) *parse.MessageFile {
+func (s *Store) missingIds(template *Store) ([]parse.Message, []parse.Type) {
 	messages := []parse.Message{}
 	types := []parse.Type{}
 	ids := s.MessageIDs()
 	sort.Strings(ids)
 	for _, id := range ids {
 		if template == nil || !template.HasMessage(id) {
-			messages = append(messages, parse.Message{id, s.Message(id)})
+			messages = append(messages, parse.Message{Id: id, Content: s.Message(id)})
 		}
 		if template == nil || len(s.MessageVarTypes(id)) != 0 && len(template.MessageVarTypes(id)) == 0 {
 			vars := []parse.Var{}
 			for name, ty := range s.MessageVarTypes(id) {
-				vars = append(vars, parse.Var{name, ty})
+				vars = append(vars, parse.Var{Name: name, Ty: ty})
 			}
-			types = append(types, parse.Type{id, vars})
+			types = append(types, parse.Type{Id: id, Vars: vars})
 		}
 	}
-	return parse.NewFromData("// Generated by ouro-tools", messages, types)
+	return messages, types
 }
 
+// Without a template, WriteText writes the root file at path, which
+// imports messages.txt and types.txt from the same directory
 func (s *Store) WriteText(path string, template *Store) error {
-	missing := s.missingIds(template)
+	p := staging.NewPlan()
+	if err := s.planText(p, path, template); err != nil {
+		return err
+	}
+	return p.Commit()
+}
 
+func (s *Store) planText(p *staging.Plan, path string, template *Store) error {
 	if template == nil {
-		return s.writeTextTo(path, missing)
+		return s.writeTree(p, path)
 	} else {
 		basedir := filepath.Dir(path)
 
@@ -117,10 +144,21 @@ func (s *Store) WriteText(path string, template *Store) error {
 			basedir = path
 		}
 
+		files := map[string]*parse.MessageFile{}
 		for relname, file := range template.inputFiles {
+			files[relname] = file
+		}
+		messages, types := s.missingIds(template)
+		messages, types, err = s.routeMissing(template, files, messages, types)
+		if err != nil {
+			return err
+		}
+		missing := parse.NewFromData("// Generated by ouro-tools", messages, types)
+
+		for relname, file := range files {
 			name := filepath.Join(basedir, relname)
 
-			if err := s.writeTextTo(name, file); err != nil {
+			if err := s.writeTextTo(p, name, file, templateData{s, template}); err != nil {
 				return err
 			}
 		}
@@ -128,7 +166,7 @@ func (s *Store) WriteText(path string, template *Store) error {
 		// Always one comment at the start, skip the file if that's all there is
 		if len(missing.Lines) > 1 {
 			name := filepath.Join(basedir, "missing-data.txt")
-			if err := s.writeTextTo(name, missing); err != nil {
+			if err := s.writeTextTo(p, name, missing, s); err != nil {
 				return err
 			}
 		}
@@ -136,29 +174,158 @@ func (s *Store) WriteText(path string, template *Store) error {
 	return nil
 }
 
-func (s *Store) writeTextTo(path string, file *parse.MessageFile) error {
-	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
-		return fmt.Errorf("failed to create directory %s: %s", filepath.Dir(path), err)
+func (s *Store) writeTree(p *staging.Plan, path string) error {
+	dir := filepath.Dir(path)
+	if info, err := os.Stat(path); (err == nil && info.IsDir()) || strings.HasSuffix(path, string(filepath.Separator)) {
+		return fmt.Errorf("can't write %s, without a template it needs the name of the root file to write, such as %s", path, filepath.Join(path, "main.txt"))
+	}
+	if base := filepath.Base(path); base == "messages.txt" || base == "types.txt" {
+		return fmt.Errorf("can't write %s, that name is needed for the imported files", path)
+	}
+
+	root := parse.NewMessageFile(false,
+		parse.NewComment("// Generated by ouro-tools"),
+		parse.NewImport("messages.txt", "types.txt"),
+	)
+	if err := s.writeTextTo(p, path, root, s); err != nil {
+		return err
+	}
+
+	ids := s.MessageIDs()
+	sort.Strings(ids)
+	messages := []parse.Message{}
+	for _, id := range ids {
+		messages = append(messages, parse.Message{Id: id, Content: s.Message(id)})
+	}
+	msgFile := parse.NewFromData("// Generated by ouro-tools", messages, nil)
+	if err := s.writeTextTo(p, filepath.Join(dir, "messages.txt"), msgFile, s); err != nil {
+		return err
 	}
 
-	f, err := os.Create(path)
+	types, err := s.typeFile(ids)
 	if err != nil {
-		return fmt.Errorf("failed to create %s: %s", path, err)
+		return err
 	}
-	defer f.Close()
+	return s.writeTextTo(p, filepath.Join(dir, "types.txt"), types, s)
+}
 
-	if !file.TypeFile {
-		// For no apparent reason, messages files have a BOM and type files do not
-		f.WriteString("\uFEFF")
+// typeFile makes type entries for the messages in ids. An entry applies
+// to the message with its own id and to those with each of typePrefixes,
+// and a message gets the variables of every entry which applies, in the
+// order they come in the file. So the entry for a family holds what its
+// members all start with, and each member has an entry for the rest.
+func (s *Store) typeFile(ids []string) (*parse.MessageFile, error) {
+	t := &typeEntries{s: s, vars: map[string][]parse.Var{}}
+	for _, id := range ids {
+		if _, err := t.entry(id); err != nil {
+			return nil, err
+		}
 	}
 
-	if s.Verbose {
-		fmt.Printf("writing %s\n", path)
+	lines := []parse.Line{}
+	for _, id := range t.order {
+		varTypes := []*parse.VarType{}
+		for _, v := range t.vars[strings.ToLower(id)] {
+			varTypes = append(varTypes, parse.NewVarType(v.Name, v.Ty))
+		}
+		lines = append(lines, parse.NewTypeEntry(id, varTypes...))
 	}
+	return parse.NewMessageFile(true, lines...), nil
+}
 
-	for _, line := range file.Lines {
-		f.WriteString(line.FormatWith(s))
+type typeEntries struct {
+	s *Store
+	// What the entry for each id holds, by lower case id
+	vars map[string][]parse.Var
+	// Ids with entries, each after the entry which applies to its family
+	order []string
+}
+
+// entry works out what the type entry for id has to hold
+func (t *typeEntries) entry(id string) ([]parse.Var, error) {
+	key := strings.ToLower(id)
+	if vars, ok := t.vars[key]; ok {
+		return vars, nil
 	}
 
-	return nil
+	var vars []parse.Var
+	if t.s.find(id) != nil {
+		// Whatever the entry for the family doesn't already give it
+		vars = t.s.MessageVars(id)
+		if base := typeBase(id); base != id {
+			head, err := t.entry(base)
+			if err != nil {
+				return nil, err
+			}
+			if len(commonVars(head, vars)) != len(head) {
+				return nil, fmt.Errorf("can't write the types of %s, the type entry for %s would also apply to it", id, base)
+			}
+			vars = vars[len(head):]
+		}
+	} else {
+		// Only there for the family, so take what they all start with
+		first := true
+		for _, prefix := range typePrefixes[1:] {
+			if msg := t.s.find(prefix + id); msg != nil {
+				member := t.s.MessageVars(msg.id)
+				if first {
+					vars = member
+					first = false
+				} else {
+					vars = commonVars(vars, member)
+				}
+			}
+		}
+	}
+
+	t.vars[key] = vars
+	if len(vars) > 0 {
+		t.order = append(t.order, id)
+	}
+	return vars, nil
+}
+
+func commonVars(a, b []parse.Var) []parse.Var {
+	n := 0
+	for n < len(a) && n < len(b) && a[n] == b[n] {
+		n++
+	}
+	return a[:n]
+}
+
+// The id of the type entry for a family of messages
+func typeBase(id string) string {
+	lower := strings.ToLower(id)
+	for _, prefix := range typePrefixes[1:] {
+		if strings.HasPrefix(lower, prefix) && len(id) > len(prefix) {
+			return id[len(prefix):]
+		}
+	}
+	return id
+}
+
+// templateData is the messages in a store, written out into the files
+// of a template. Duplicate definitions in the template are kept as they
+// are, since they were never used.
+type templateData struct {
+	*Store
+	template *Store
+}
+
+func (d templateData) MessageDefinition(id string) (parse.Position, bool) {
+	return d.template.MessageDefinition(id)
+}
+
+func (s *Store) writeTextTo(p *staging.Plan, path string, file *parse.MessageFile, data parse.MessageData) error {
+	count := 0
+	file.Walk(func(line parse.Line) {
+		if m, ok := line.(*parse.MessageEntry); ok && data.HasMessage(m.ID()) {
+			count++
+		}
+	})
+	text, err := file.FormatWith(data)
+	if err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return p.Add(path, []byte(text), count)
 }
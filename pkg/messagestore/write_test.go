@@ -0,0 +1,103 @@
+package messagestore
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/asuffield/ouro-tools/pkg/messagestore/parse"
+)
+
+// Content that neither string form can hold is an error, not a corrupt file
+func TestWriteTextUnencodable(t *testing.T) {
+	s := sampleStore(t)
+	s.add("broken", "ends in a slash >> \\", parse.Position{})
+
+	dir := t.TempDir()
+	err := s.WriteText(filepath.Join(dir, "root.txt"), nil)
+	var ee *parse.EncodeError
+	if !errors.As(err, &ee) || ee.ID != "broken" {
+		t.Fatalf("got %v, want an EncodeError for broken", err)
+	}
+	if files, _ := filepath.Glob(filepath.Join(dir, "*")); len(files) != 0 {
+		t.Errorf("wrote %v", files)
+	}
+}
+
+// Text written without a template reads back with the same types, even
+// when the members of a family don't all have the same ones
+func TestWriteTreeFamilies(t *testing.T) {
+	dir := makeTree(t, map[string]string{
+		"main.txt": "\"foo\" \"{a}\"\n\"v_foo\" \"{a} {b}\"\n\"p_foo\" \"{a}\"\n" +
+			"\"v_bar\" \"{x}\"\n\"p_bar\" \"{y}\"\n" +
+			"\"baz\" \"{z}\"\n\"v_baz\" \"{z}\"\n\"l_baz\" \"{z}\"\n" +
+			"\"v_qux\" \"{q} {r}\"\n\"l_qux\" \"{q}\"\n" +
+			"\"plain\" \"none\"\n" +
+			"import sub.txt types.txt\n",
+		"sub.txt": "",
+		"types.txt": "\"foo\" {a,int}\n\"v_foo\" {b,string}\n" +
+			"\"v_bar\" {x,int}\n\"p_bar\" {y,int}\n" +
+			"\"baz\" {z,int}\n" +
+			"\"v_qux\" {q,int} {r,int}\n\"l_qux\" {q,int}\n",
+	})
+	text := readStore(t, filepath.Join(dir, "main.txt"))
+	if got := formatVars(text.MessageVars("v_foo")); got != "{a,int} {b,string}" {
+		t.Fatalf("v_foo has %s", got)
+	}
+
+	bin := NewStore()
+	if err := NewDecoder(bytes.NewReader(encode(t, text))).Decode(bin); err != nil {
+		t.Fatal(err)
+	}
+	out := filepath.Join(t.TempDir(), "root.txt")
+	if err := bin.WriteText(out, nil); err != nil {
+		t.Fatal(err)
+	}
+	sameContent(t, bin, readStore(t, out))
+	sameContent(t, text, readStore(t, out))
+
+	types, err := os.ReadFile(filepath.Join(filepath.Dir(out), "types.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "\"baz\" {z,int}\r\n" +
+		"\"foo\" {a,int}\r\n" +
+		"\"qux\" {q,int}\r\n" +
+		"\"p_bar\" {y,int}\r\n" +
+		"\"v_bar\" {x,int}\r\n" +
+		"\"v_foo\" {b,string}\r\n" +
+		"\"v_qux\" {r,int}\r\n"
+	if string(types) != want {
+		t.Errorf("types file is\n%s\nwant\n%s", types, want)
+	}
+}
+
+// A family entry which would give a member the wrong types is an error
+func TestWriteTreeConflictingFamily(t *testing.T) {
+	s := readStore(t, filepath.Join(makeTree(t, map[string]string{
+		"main.txt":  "\"foo\" \"{a}\"\n\"v_foo\" \"{b}\"\nimport sub.txt types.txt\n",
+		"sub.txt":   "",
+		"types.txt": "\"foo\" {a,int}\n",
+	}), "main.txt"))
+	// Only possible in a binary file
+	s.messages["v_foo"].varIndices = []int{s.variableTable.Add("b")}
+	s.variableTable.Add("int")
+
+	err := s.WriteText(filepath.Join(t.TempDir(), "root.txt"), nil)
+	if err == nil || !strings.Contains(err.Error(), "the type entry for foo would also apply to it") {
+		t.Fatalf("got %v", err)
+	}
+}
+
+func TestWriteTreeDirectory(t *testing.T) {
+	s := sampleStore(t)
+	dir := t.TempDir()
+	for _, path := range []string{dir, filepath.Join(dir, "new") + string(filepath.Separator)} {
+		if err := s.WriteText(path, nil); err == nil || !strings.Contains(err.Error(), "needs the name of the root file") {
+			t.Errorf("%s: got %v", path, err)
+		}
+	}
+}
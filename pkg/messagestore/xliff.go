@@ -0,0 +1,324 @@
+package messagestore
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/asuffield/ouro-tools/pkg/messagestore/parse"
+	"github.com/asuffield/ouro-tools/pkg/staging"
+)
+
+// XLIFF 2.0, for CAT tools. Each file of the source tree is a <file>,
+// each message a <unit> named after its id, and variables in the text
+// are <ph> placeholders which the tools won't let translators break.
+// Source and target work like msgid and msgstr in po.go.
+type xliffFormat struct{}
+
+func init() {
+	RegisterFormat(xliffFormat{})
+}
+
+const xliffNamespace = "urn:oasis:names:tc:xliff:document:2.0"
+
+func (xliffFormat) Name() string {
+	return "xliff"
+}
+
+func (xliffFormat) Detect(path string, head []byte) bool {
+	if strings.HasSuffix(path, ".xlf") || strings.HasSuffix(path, ".xliff") {
+		return true
+	}
+	return bytes.Contains(head, []byte(xliffNamespace))
+}
+
+var (
+	nmtokenPattern = regexp.MustCompile(`^[\w.:-]+$`)
+	langPattern    = regexp.MustCompile(`^[a-zA-Z]{2,3}([-_][a-zA-Z0-9]+)*$`)
+)
+
+func (xliffFormat) Write(p *staging.Plan, s *Store, path string, template *Store) error {
+	source := s
+	if template != nil {
+		source = template
+	}
+	comments := source.comments()
+
+	ids := s.MessageIDs()
+	source.sourceOrder(ids)
+	files := []string{}
+	byFile := map[string][]string{}
+	for _, id := range ids {
+		pos, _ := source.MessageDefinition(id)
+		if byFile[pos.File] == nil {
+			files = append(files, pos.File)
+		}
+		byFile[pos.File] = append(byFile[pos.File], id)
+	}
+
+	var b bytes.Buffer
+	b.WriteString(xml.Header)
+	fmt.Fprintf(&b, `<xliff xmlns="%s" version="2.0" srcLang="en"`, xliffNamespace)
+	if template != nil {
+		// The target language comes from names like fr.xlf
+		lang := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+		if !langPattern.MatchString(lang) {
+			lang = "und"
+		}
+		fmt.Fprintf(&b, ` trgLang="%s"`, xmlEscape(lang))
+	}
+	b.WriteString(">\n")
+
+	for i, file := range files {
+		fmt.Fprintf(&b, `  <file id="f%d"`, i+1)
+		if file != "" {
+			fmt.Fprintf(&b, ` original="%s"`, xmlEscape(file))
+		}
+		b.WriteString(">\n")
+		// Ids which can't be unit ids get numbered ones instead, skipping
+		// any that another message is already using
+		used := map[string]bool{}
+		for _, id := range byFile[file] {
+			used[id] = true
+		}
+		n := 0
+		for _, id := range byFile[file] {
+			unitID := id
+			if !nmtokenPattern.MatchString(id) {
+				for used[unitID] || !nmtokenPattern.MatchString(unitID) {
+					n++
+					unitID = fmt.Sprintf("u%d", n)
+				}
+				used[unitID] = true
+			}
+			fmt.Fprintf(&b, `    <unit id="%s" name="%s">`+"\n", xmlEscape(unitID), xmlEscape(id))
+
+			vars := s.MessageVars(id)
+			if len(vars) > 0 || len(comments[strings.ToLower(id)]) > 0 {
+				b.WriteString("      <notes>\n")
+				for _, c := range comments[strings.ToLower(id)] {
+					fmt.Fprintf(&b, "        <note category=\"comment\">%s</note>\n", xmlEscape(commentText(c)))
+				}
+				if len(vars) > 0 {
+					fmt.Fprintf(&b, "        <note category=\"types\">%s</note>\n", xmlEscape(formatVars(vars)))
+				}
+				b.WriteString("      </notes>\n")
+			}
+
+			text, translation := s.Message(id), ""
+			if template != nil && template.HasMessage(id) {
+				text, translation = template.Message(id), s.Message(id)
+			}
+			b.WriteString("      <segment>\n")
+			src, err := xliffInline(text, vars)
+			if err != nil {
+				return fmt.Errorf("can't write %s to %s: %s", id, path, err)
+			}
+			fmt.Fprintf(&b, "        <source xml:space=\"preserve\">%s</source>\n", src)
+			if translation != "" && translation != text {
+				tgt, err := xliffInline(translation, vars)
+				if err != nil {
+					return fmt.Errorf("can't write %s to %s: %s", id, path, err)
+				}
+				fmt.Fprintf(&b, "        <target xml:space=\"preserve\">%s</target>\n", tgt)
+			}
+			b.WriteString("      </segment>\n")
+			b.WriteString("    </unit>\n")
+		}
+		b.WriteString("  </file>\n")
+	}
+	b.WriteString("</xliff>\n")
+
+	return p.Add(path, b.Bytes(), len(ids))
+}
+
+// xmlEscape escapes text for content or attributes, keeping \r which
+// XML would otherwise turn into \n
+func xmlEscape(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch r {
+		case '&':
+			b.WriteString("&amp;")
+		case '<':
+			b.WriteString("&lt;")
+		case '>':
+			b.WriteString("&gt;")
+		case '"':
+			b.WriteString("&quot;")
+		case '\r':
+			b.WriteString("&#xD;")
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+var placeholderPattern = regexp.MustCompile(`\{([^{}]*)\}`)
+
+// placeholderIDs are named after the variables, so that source and target
+// agree on them whatever order the translation puts the variables in.
+// Names which can't be ids are numbered by their place in vars instead.
+func placeholderIDs(vars []parse.Var) (map[string]string, map[string]bool) {
+	ids := map[string]string{}
+	used := map[string]bool{}
+	for _, v := range vars {
+		if nmtokenPattern.MatchString(v.Name) {
+			ids[v.Name] = v.Name
+			used[v.Name] = true
+		}
+	}
+	for i, v := range vars {
+		if _, ok := ids[v.Name]; ok {
+			continue
+		}
+		id := fmt.Sprintf("v%d", i+1)
+		for n := 2; used[id]; n++ {
+			id = fmt.Sprintf("v%d.%d", i+1, n)
+		}
+		ids[v.Name] = id
+		used[id] = true
+	}
+	return ids, used
+}
+
+// xliffInline writes text with each {name} of a known variable as a
+// placeholder. A variable used more than once gets a numbered id for
+// each use after the first.
+func xliffInline(text string, vars []parse.Var) (string, error) {
+	for _, r := range text {
+		if r < 0x20 && r != '\t' && r != '\n' && r != '\r' {
+			return "", fmt.Errorf("XML can't hold the character %q", r)
+		}
+	}
+
+	ids, used := placeholderIDs(vars)
+	uses := map[string]int{}
+
+	var b strings.Builder
+	last := 0
+	for _, m := range placeholderPattern.FindAllStringSubmatchIndex(text, -1) {
+		name := text[m[2]:m[3]]
+		id, ok := ids[name]
+		if !ok {
+			continue
+		}
+		uses[name]++
+		if uses[name] > 1 {
+			base := id
+			for n := uses[name]; ; n++ {
+				id = fmt.Sprintf("%s.%d", base, n)
+				if !used[id] {
+					break
+				}
+			}
+			used[id] = true
+		}
+		b.WriteString(xmlEscape(text[last:m[0]]))
+		ph := xmlEscape(text[m[0]:m[1]])
+		fmt.Fprintf(&b, `<ph id="%s" disp="%s" equiv="%s" canCopy="no" canDelete="no"/>`, xmlEscape(id), ph, ph)
+		last = m[1]
+	}
+	b.WriteString(xmlEscape(text[last:]))
+	return b.String(), nil
+}
+
+func xmlAttr(e xml.StartElement, name string) string {
+	for _, a := range e.Attr {
+		if a.Name.Local == name {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+func (xliffFormat) Read(s *Store, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var (
+		id, types              string
+		text, translation      *strings.Builder
+		hasTarget, inTypesNote bool
+		current                *strings.Builder
+		// What each placeholder in the source stood for, in case the
+		// target only has the ids
+		placeholders map[string]string
+	)
+	d := xml.NewDecoder(f)
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %s", path, err)
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "unit":
+				id = xmlAttr(t, "name")
+				if id == "" {
+					id = xmlAttr(t, "id")
+				}
+				types, hasTarget = "", false
+				text, translation = &strings.Builder{}, &strings.Builder{}
+				placeholders = map[string]string{}
+			case "note":
+				inTypesNote = xmlAttr(t, "category") == "types"
+			case "source":
+				current = text
+			case "target":
+				current = translation
+				hasTarget = true
+			case "ph":
+				// Placeholders go back to being the variable they stand for
+				if current == nil {
+					break
+				}
+				equiv := xmlAttr(t, "equiv")
+				if current == text {
+					placeholders[xmlAttr(t, "id")] = equiv
+				} else if equiv == "" {
+					equiv = placeholders[xmlAttr(t, "id")]
+				}
+				current.WriteString(equiv)
+			}
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "note":
+				inTypesNote = false
+			case "source", "target":
+				current = nil
+			case "unit":
+				content := text.String()
+				if hasTarget {
+					content = translation.String()
+				}
+				msg := s.add(id, content, parse.Position{})
+				if msg == nil {
+					return fmt.Errorf("failed to read %s: duplicate message %s", path, id)
+				}
+				s.addVars(msg, parseVars(types))
+			}
+		case xml.CharData:
+			if inTypesNote {
+				types += string(t)
+			} else if current != nil {
+				current.Write(t)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+package messagestore
+
+import (
+	"encoding/xml"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/asuffield/ouro-tools/pkg/messagestore/parse"
+)
+
+func TestXLIFFRoundTrip(t *testing.T) {
+	s := trickyStore(t)
+	sameContent(t, s, writeAndRead(t, s, "out.xlf", nil))
+
+	template := sampleStore(t)
+	fr := translatedStore(t)
+	sameContent(t, fr, writeAndRead(t, fr, "fr.xlf", template))
+}
+
+// Ids which can't be unit ids are numbered, without taking the unit id
+// of any other message
+func TestXLIFFUnitIDs(t *testing.T) {
+	dir := makeTree(t, map[string]string{
+		"main.txt": "\"has space\" \"a\"\n\"u1\" \"b\"\n\"other space\" \"c\"\n\"u3\" \"d\"\n",
+	})
+	s := readStore(t, filepath.Join(dir, "main.txt"))
+	path := filepath.Join(t.TempDir(), "out.xlf")
+	if err := s.Write(path, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	var doc struct {
+		Units []struct {
+			ID   string `xml:"id,attr"`
+			Name string `xml:"name,attr"`
+		} `xml:"file>unit"`
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := xml.Unmarshal(data, &doc); err != nil {
+		t.Fatal(err)
+	}
+	seen := map[string]string{}
+	for _, u := range doc.Units {
+		if other, ok := seen[u.ID]; ok {
+			t.Errorf("%s and %s both have unit id %s", other, u.Name, u.ID)
+		}
+		seen[u.ID] = u.Name
+	}
+	if len(doc.Units) != 4 {
+		t.Errorf("wrote %d units, want 4", len(doc.Units))
+	}
+	sameContent(t, s, readStore(t, path))
+}
+
+// Placeholders are named after their variables, so a translation which
+// moves them around still means the same thing, even when a tool only
+// keeps their ids
+func TestXLIFFReorderedPlaceholders(t *testing.T) {
+	template := readStore(t, filepath.Join(makeTree(t, map[string]string{
+		"main.txt":  "\"count\" \"{n} of {total}, {n} left\"\nimport sub.txt types.txt\n",
+		"sub.txt":   "",
+		"types.txt": "\"count\" {n,int} {total,int}\n",
+	}), "main.txt"))
+	path := filepath.Join(t.TempDir(), "fr.xlf")
+	if err := template.Write(path, template); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	src := `<source xml:space="preserve">` +
+		`<ph id="n" disp="{n}" equiv="{n}" canCopy="no" canDelete="no"/> of ` +
+		`<ph id="total" disp="{total}" equiv="{total}" canCopy="no" canDelete="no"/>, ` +
+		`<ph id="n.2" disp="{n}" equiv="{n}" canCopy="no" canDelete="no"/> left</source>`
+	if !strings.Contains(string(data), src) {
+		t.Fatalf("no %s in\n%s", src, data)
+	}
+
+	translated := strings.Replace(string(data), "</source>", "</source>\n        "+
+		`<target xml:space="preserve">sur <ph id="total"/>, <ph id="n.2"/> restent après <ph id="n" equiv="{n}"/></target>`, 1)
+	if err := os.WriteFile(path, []byte(translated), 0644); err != nil {
+		t.Fatal(err)
+	}
+	fr := readStore(t, path)
+	if got, want := fr.Message("count"), "sur {total}, {n} restent après {n}"; got != want {
+		t.Errorf("read %q, want %q", got, want)
+	}
+}
+
+// Names which can't be ids are numbered by where they are in the types
+func TestPlaceholderIDs(t *testing.T) {
+	ids, _ := placeholderIDs([]parse.Var{{Name: "a b"}, {Name: "v1"}, {Name: "ok"}})
+	if ids["a b"] != "v1.2" || ids["v1"] != "v1" || ids["ok"] != "ok" {
+		t.Errorf("ids are %v", ids)
+	}
+}
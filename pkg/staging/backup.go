@@ -0,0 +1,161 @@
+package staging
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Backups of path are path.bak for the newest, then path.bak.1 and so on
+func backupName(path string, generation int) string {
+	if generation == 0 {
+		return path + ".bak"
+	}
+	return fmt.Sprintf("%s.bak.%d", path, generation)
+}
+
+// A generation in which the file didn't exist at all is marked by an
+// empty file with this added to the backup name, so that restoring it
+// removes the file
+const absent = ".none"
+
+var backupPattern = regexp.MustCompile(`\.bak(\.[0-9]+)?(\.none)?$`)
+
+// IsBackup is whether path is one of the backups made by a Plan
+func IsBackup(path string) bool {
+	return backupPattern.MatchString(path)
+}
+
+// rotate moves every backup of path down a generation, to make room for
+// a new one, keeping at most generations of them
+func rotate(path string, generations int) error {
+	for _, suffix := range []string{"", absent} {
+		os.Remove(backupName(path, generations-1) + suffix)
+	}
+	for i := generations - 2; i >= 0; i-- {
+		for _, suffix := range []string{"", absent} {
+			if err := os.Rename(backupName(path, i)+suffix, backupName(path, i+1)+suffix); err != nil && !os.IsNotExist(err) {
+				return fmt.Errorf("failed to rotate backups of %s: %s", path, err)
+			}
+		}
+	}
+	return nil
+}
+
+// backup copies path to the newest backup. The file itself is left in
+// place, so that it can be replaced with a single rename.
+func backup(path string, generations int) error {
+	if err := rotate(path, generations); err != nil {
+		return err
+	}
+
+	bak := backupName(path, 0)
+	if err := os.Link(path, bak); err == nil {
+		return nil
+	}
+	// Not every filesystem has hard links
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %s", path, err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("failed to stat %s: %s", path, err)
+	}
+	if err := ioutil.WriteFile(bak, data, info.Mode().Perm()); err != nil {
+		return fmt.Errorf("failed to write %s: %s", bak, err)
+	}
+	return nil
+}
+
+// backupAbsent records that path is about to be created, so that
+// restoring it removes it again
+func backupAbsent(path string, generations int) error {
+	if err := rotate(path, generations); err != nil {
+		return err
+	}
+	bak := backupName(path, 0) + absent
+	if err := ioutil.WriteFile(bak, nil, 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %s", bak, err)
+	}
+	return nil
+}
+
+// Restore rolls path, or every file under it if it's a directory, back
+// to the newest backup, and moves the older backups up a generation.
+// Files which didn't exist before are removed. Returns the files which
+// were restored and those which were removed.
+func Restore(path string) ([]string, []string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	backups := []string{}
+	if !info.IsDir() {
+		for _, bak := range []string{backupName(path, 0), backupName(path, 0) + absent} {
+			if _, err := os.Stat(bak); err == nil {
+				backups = append(backups, bak)
+			}
+		}
+	} else {
+		err := filepath.Walk(path, func(name string, info os.FileInfo, err error) error {
+			if err != nil {
+				return fmt.Errorf("failed to walk %s: %s", name, err)
+			}
+			if !info.IsDir() && (strings.HasSuffix(name, ".bak") || strings.HasSuffix(name, ".bak"+absent)) {
+				backups = append(backups, name)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	sort.Strings(backups)
+
+	restored := []string{}
+	removed := []string{}
+	for _, bak := range backups {
+		if strings.HasSuffix(bak, absent) {
+			orig := strings.TrimSuffix(bak, ".bak"+absent)
+			if err := os.Remove(orig); err != nil && !os.IsNotExist(err) {
+				return restored, removed, fmt.Errorf("failed to remove %s: %s", orig, err)
+			}
+			if err := os.Remove(bak); err != nil {
+				return restored, removed, fmt.Errorf("failed to remove %s: %s", bak, err)
+			}
+			removed = append(removed, orig)
+		} else {
+			orig := strings.TrimSuffix(bak, ".bak")
+			if err := os.Rename(bak, orig); err != nil {
+				return restored, removed, fmt.Errorf("failed to restore %s: %s", orig, err)
+			}
+			restored = append(restored, orig)
+		}
+	}
+
+	// Then the older generations move up
+	for _, bak := range backups {
+		orig := strings.TrimSuffix(strings.TrimSuffix(bak, absent), ".bak")
+		for i := 1; ; i++ {
+			found := false
+			for _, suffix := range []string{"", absent} {
+				err := os.Rename(backupName(orig, i)+suffix, backupName(orig, i-1)+suffix)
+				if err == nil {
+					found = true
+				} else if !os.IsNotExist(err) {
+					return restored, removed, fmt.Errorf("failed to rotate backups of %s: %s", orig, err)
+				}
+			}
+			if !found {
+				break
+			}
+		}
+	}
+	return restored, removed, nil
+}
@@ -0,0 +1,126 @@
+package staging
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func commit(t *testing.T, backups int, files map[string]string) {
+	t.Helper()
+	p := NewPlan()
+	p.Backups = backups
+	for path, content := range files {
+		if err := p.Add(path, []byte(content), 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := p.Commit(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+func TestBackupRotation(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "a.txt")
+	for _, content := range []string{"1", "2", "3", "4"} {
+		commit(t, 2, map[string]string{path: content})
+	}
+	if got := readFile(t, path+".bak"); got != "3" {
+		t.Errorf(".bak is %q", got)
+	}
+	if got := readFile(t, path+".bak.1"); got != "2" {
+		t.Errorf(".bak.1 is %q", got)
+	}
+	if exists(path+".bak.2") || exists(path+".bak.1.none") {
+		t.Errorf("kept too many backups")
+	}
+
+	for _, want := range []string{"3", "2"} {
+		if _, _, err := Restore(path); err != nil {
+			t.Fatal(err)
+		}
+		if got := readFile(t, path); got != want {
+			t.Errorf("restored %q, want %q", got, want)
+		}
+	}
+	if restored, removed, err := Restore(path); err != nil || len(restored)+len(removed) != 0 {
+		t.Errorf("restored %v and removed %v, %v, with no backups left", restored, removed, err)
+	}
+}
+
+// Restoring a tree puts back what was overwritten, and removes what was
+// created, going back a generation at a time
+func TestRestoreTree(t *testing.T) {
+	dir := t.TempDir()
+	old := filepath.Join(dir, "old.txt")
+	created := filepath.Join(dir, "sub", "created.txt")
+	writeFile(t, old, "original")
+
+	commit(t, 3, map[string]string{old: "first", created: "first"})
+	commit(t, 3, map[string]string{old: "second", created: "second"})
+
+	restored, removed, err := Restore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(restored) != 2 || len(removed) != 0 {
+		t.Errorf("restored %v and removed %v", restored, removed)
+	}
+	if readFile(t, old) != "first" || readFile(t, created) != "first" {
+		t.Errorf("didn't go back to the first commit")
+	}
+
+	restored, removed, err = Restore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(restored) != 1 || len(removed) != 1 || removed[0] != created {
+		t.Errorf("restored %v and removed %v", restored, removed)
+	}
+	if readFile(t, old) != "original" || exists(created) {
+		t.Errorf("didn't go back to before the first commit")
+	}
+	entries, _ := os.ReadDir(filepath.Join(dir, "sub"))
+	if len(entries) != 0 {
+		t.Errorf("left behind %v", entries)
+	}
+}
+
+func TestIsBackup(t *testing.T) {
+	for path, want := range map[string]bool{
+		"a.txt.bak": true, "a.txt.bak.3": true, "a.txt.bak.none": true, "a.txt.bak.1.none": true,
+		"a.txt": false, "a.bakery": false, "a.txt.none": false,
+	} {
+		if IsBackup(path) != want {
+			t.Errorf("IsBackup(%q) is %v", path, !want)
+		}
+	}
+}
+
+// A file which a commit leaves alone is still backed up, so that going
+// back a generation gives the tree as that commit left it, and not a
+// mixture of different commits
+func TestRestoreUnchanged(t *testing.T) {
+	dir := t.TempDir()
+	a := filepath.Join(dir, "a.txt")
+	b := filepath.Join(dir, "b.txt")
+
+	commit(t, 3, map[string]string{a: "A1", b: "B1"})
+	commit(t, 3, map[string]string{a: "A2", b: "B2"})
+	commit(t, 3, map[string]string{a: "A3", b: "B2"})
+
+	for _, want := range []string{"A2 B2", "A1 B1"} {
+		if _, _, err := Restore(dir); err != nil {
+			t.Fatal(err)
+		}
+		if got := readFile(t, a) + " " + readFile(t, b); got != want {
+			t.Errorf("restored %q, want %q", got, want)
+		}
+	}
+}
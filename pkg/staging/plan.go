@@ -0,0 +1,170 @@
+package staging
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+type Status int
+
+const (
+	Created Status = iota
+	Modified
+	Unchanged
+)
+
+func (s Status) String() string {
+	switch s {
+	case Created:
+		return "created"
+	case Modified:
+		return "modified"
+	case Unchanged:
+		return "unchanged"
+	}
+	return fmt.Sprintf("Status(%d)", int(s))
+}
+
+// File is one file to be written by a Plan
+type File struct {
+	Path     string
+	Data     []byte
+	Messages int
+	Status   Status
+	mode     os.FileMode
+}
+
+// Plan collects a set of files to write, so that they can be checked
+// before anything is touched, and then written all at once
+type Plan struct {
+	// How many generations of backups to keep, see Restore. Every file
+	// in the plan is backed up, even if it's unchanged, so that each
+	// generation is the whole tree as one commit left it.
+	Backups int
+
+	files map[string]*File
+}
+
+func NewPlan() *Plan {
+	return &Plan{files: map[string]*File{}}
+}
+
+// Add puts a file in the plan, comparing it with what is on disk now.
+// Messages is how many messages the file holds, for the summary.
+func (p *Plan) Add(path string, data []byte, messages int) error {
+	f := &File{Path: path, Data: data, Messages: messages, Status: Created, mode: 0644}
+	old, err := ioutil.ReadFile(path)
+	if err == nil {
+		f.Status = Modified
+		if bytes.Equal(old, data) {
+			f.Status = Unchanged
+		}
+		if info, err := os.Stat(path); err == nil {
+			f.mode = info.Mode().Perm()
+		}
+	} else if !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read %s: %s", path, err)
+	}
+	p.files[path] = f
+	return nil
+}
+
+// Files lists everything in the plan, in order of path
+func (p *Plan) Files() []*File {
+	files := []*File{}
+	for _, f := range p.files {
+		files = append(files, f)
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Path < files[j].Path })
+	return files
+}
+
+// Commit writes every file which has changed into a temporary file next
+// to it, and only once they have all been written, renames them into
+// place. If anything fails before that, nothing is changed.
+func (p *Plan) Commit() error {
+	staged := map[string]string{}
+	cleanup := func() {
+		for _, tmp := range staged {
+			os.Remove(tmp)
+		}
+	}
+
+	for _, f := range p.Files() {
+		if f.Status == Unchanged {
+			continue
+		}
+		tmp, err := stage(f)
+		if err != nil {
+			cleanup()
+			return err
+		}
+		staged[f.Path] = tmp
+	}
+
+	for _, f := range p.Files() {
+		if f.Status == Created && p.Backups > 0 {
+			if err := backupAbsent(f.Path, p.Backups); err != nil {
+				cleanup()
+				return err
+			}
+		} else if p.Backups > 0 {
+			if err := backup(f.Path, p.Backups); err != nil {
+				cleanup()
+				return err
+			}
+		}
+		tmp, ok := staged[f.Path]
+		if !ok {
+			continue
+		}
+		if err := os.Rename(tmp, f.Path); err != nil {
+			cleanup()
+			return fmt.Errorf("failed to rename %s to %s: %s", tmp, f.Path, err)
+		}
+		delete(staged, f.Path)
+	}
+	return nil
+}
+
+func stage(f *File) (string, error) {
+	dir := filepath.Dir(f.Path)
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return "", fmt.Errorf("failed to create directory %s: %s", dir, err)
+	}
+
+	tmp, err := ioutil.TempFile(dir, "."+filepath.Base(f.Path)+".")
+	if err != nil {
+		return "", fmt.Errorf("failed to create temporary file for %s: %s", f.Path, err)
+	}
+	if _, err := tmp.Write(f.Data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return "", fmt.Errorf("failed to write %s: %s", tmp.Name(), err)
+	}
+	if err := tmp.Chmod(f.mode); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return "", fmt.Errorf("failed to set mode of %s: %s", tmp.Name(), err)
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return "", fmt.Errorf("failed to write %s: %s", tmp.Name(), err)
+	}
+	return tmp.Name(), nil
+}
+
+// Summary lists every file in the plan and what will happen to it
+func (p *Plan) Summary(w io.Writer) {
+	counts := map[Status]int{}
+	for _, f := range p.Files() {
+		fmt.Fprintf(w, "%-9s %s (%d messages)\n", f.Status, f.Path, f.Messages)
+		counts[f.Status]++
+	}
+	fmt.Fprintf(w, "%d created, %d modified, %d unchanged\n", counts[Created], counts[Modified], counts[Unchanged])
+}
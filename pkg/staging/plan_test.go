@@ -0,0 +1,102 @@
+package staging
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestPlanStatus(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "same.txt"), "same")
+	writeFile(t, filepath.Join(dir, "changed.txt"), "old")
+
+	p := NewPlan()
+	for name, content := range map[string]string{"same.txt": "same", "changed.txt": "new", "sub/new.txt": "new"} {
+		if err := p.Add(filepath.Join(dir, name), []byte(content), 2); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want := map[string]Status{"same.txt": Unchanged, "changed.txt": Modified, "sub/new.txt": Created}
+	for _, f := range p.Files() {
+		rel, _ := filepath.Rel(dir, f.Path)
+		if f.Status != want[filepath.ToSlash(rel)] {
+			t.Errorf("%s is %s, want %s", rel, f.Status, want[rel])
+		}
+	}
+
+	var b strings.Builder
+	p.Summary(&b)
+	if !strings.HasSuffix(b.String(), "1 created, 1 modified, 1 unchanged\n") || !strings.Contains(b.String(), "(2 messages)") {
+		t.Errorf("summary is\n%s", b.String())
+	}
+}
+
+func TestPlanCommit(t *testing.T) {
+	dir := t.TempDir()
+	same := filepath.Join(dir, "same.txt")
+	writeFile(t, same, "same")
+	os.Chmod(same, 0600)
+	before, _ := os.Stat(same)
+
+	p := NewPlan()
+	p.Add(same, []byte("same"), 0)
+	p.Add(filepath.Join(dir, "sub", "new.txt"), []byte("new"), 0)
+	if err := p.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := readFile(t, filepath.Join(dir, "sub", "new.txt")); got != "new" {
+		t.Errorf("new.txt is %q", got)
+	}
+	// Unchanged files aren't touched at all
+	after, _ := os.Stat(same)
+	if !after.ModTime().Equal(before.ModTime()) || after.Mode() != before.Mode() {
+		t.Errorf("same.txt was rewritten")
+	}
+	// No temporary files are left behind
+	entries, _ := os.ReadDir(filepath.Join(dir, "sub"))
+	if len(entries) != 1 {
+		t.Errorf("sub has %v", entries)
+	}
+}
+
+// If anything can't be written, nothing is
+func TestPlanCommitFailure(t *testing.T) {
+	dir := t.TempDir()
+	good := filepath.Join(dir, "good.txt")
+	writeFile(t, good, "old")
+
+	p := NewPlan()
+	p.Add(good, []byte("new"), 0)
+	p.Add(filepath.Join(dir, "sub", "bad.txt"), []byte("new"), 0)
+	// Now the directory can't be made, because there's a file there
+	writeFile(t, filepath.Join(dir, "sub"), "")
+	if err := p.Commit(); err == nil {
+		t.Fatal("commit succeeded")
+	}
+	if got := readFile(t, good); got != "old" {
+		t.Errorf("good.txt is %q", got)
+	}
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 2 {
+		t.Errorf("left behind %v", entries)
+	}
+}
@@ -0,0 +1,43 @@
+package stringtable
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+var (
+	// ErrTruncated means the data ended before the table did
+	ErrTruncated = errors.New("truncated")
+	// ErrLimitExceeded means the table is larger than MaxCount or MaxBytes allow
+	ErrLimitExceeded = errors.New("limit exceeded")
+	// ErrMalformed means the header contradicts itself
+	ErrMalformed = errors.New("malformed")
+)
+
+// Error is a problem decoding a table. Offset is from the start of the
+// table, and Err is one of the errors above or an I/O error.
+type Error struct {
+	Offset int64
+	Msg    string
+	Err    error
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s at offset %d: %s", e.Msg, e.Offset, e.Err)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+func fail(offset int64, err error, format string, args ...interface{}) error {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		err = ErrTruncated
+	}
+	return &Error{
+		Offset: offset,
+		Msg:    fmt.Sprintf(format, args...),
+		Err:    err,
+	}
+}
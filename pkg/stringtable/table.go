@@ -11,8 +11,16 @@ import (
 )
 
 type Table struct {
+	// Limits on what Read and Load will accept, zero means no limit
+	MaxCount, MaxBytes int
+
 	strings []string
 	index   map[string]int
+
+	// A lazy table decodes entries out of data on demand, and only
+	// builds strings and index once it is modified
+	data    []byte
+	offsets []int
 }
 
 func New() *Table {
@@ -21,32 +29,161 @@ func New() *Table {
 	}
 }
 
+func (t *Table) checkHeader(count, byteLen uint32) error {
+	if t.MaxCount > 0 && uint64(count) > uint64(t.MaxCount) {
+		return fail(0, ErrLimitExceeded, "stringtable has %d strings, limit is %d", count, t.MaxCount)
+	}
+	if t.MaxBytes > 0 && uint64(byteLen) > uint64(t.MaxBytes) {
+		return fail(4, ErrLimitExceeded, "stringtable has %d bytes, limit is %d", byteLen, t.MaxBytes)
+	}
+	// Every string but the last needs at least a terminator
+	if uint64(count) > uint64(byteLen)+1 {
+		return fail(0, ErrMalformed, "stringtable claims %d strings in only %d bytes", count, byteLen)
+	}
+	return nil
+}
+
+// Errors from Read, ReadPartial and Load are *Error
 func (t *Table) Read(r io.Reader) error {
+	return t.read(r, false)
+}
+
+// ReadPartial is like Read, but when the table is damaged it keeps
+// every complete string it could read before returning the error
+func (t *Table) ReadPartial(r io.Reader) error {
+	return t.read(r, true)
+}
+
+func (t *Table) read(r io.Reader, partial bool) error {
 	var count, byteLen uint32
 	if err := binary.Read(r, binary.LittleEndian, &count); err != nil {
-		return err
+		return fail(0, err, "failed to read stringtable count")
 	}
 	if err := binary.Read(r, binary.LittleEndian, &byteLen); err != nil {
+		return fail(4, err, "failed to read stringtable length")
+	}
+	if err := t.checkHeader(count, byteLen); err != nil {
 		return err
 	}
 
-	data := make([]byte, byteLen)
-	if n, err := r.Read(data); err != nil || n != int(byteLen) {
-		return fmt.Errorf("failed to read stringtable, got %d of %d bytes, err %s", n, byteLen, err)
+	// Grow the buffer as data actually arrives, rather than trusting
+	// byteLen for the allocation
+	var buf bytes.Buffer
+	n, err := io.CopyN(&buf, r, int64(byteLen))
+	if err != nil {
+		err = fail(8+n, err, "failed to read stringtable, got %d of %d bytes", n, byteLen)
+		if !partial {
+			return err
+		}
 	}
 
-	strings := bytes.Split(data, []byte{0})
-	if len(strings) < int(count) {
-		return fmt.Errorf("failed to read stringtable, got %d of %d strings", len(strings), count)
+	strings := bytes.Split(buf.Bytes(), []byte{0})
+	if err != nil {
+		// The last string was cut off
+		strings = strings[:len(strings)-1]
+	} else if len(strings) < int(count) {
+		err = fail(8+int64(byteLen), ErrMalformed, "stringtable claims %d strings, but its %d bytes only hold %d", count, byteLen, len(strings))
+		if !partial {
+			return err
+		}
+	}
+	if len(strings) > int(count) {
+		strings = strings[:count]
 	}
 
-	for _, s := range strings[0:count] {
+	for _, s := range strings {
 		t.strings = append(t.strings, string(s))
 	}
 
 	t.reindex()
 
-	return nil
+	return err
+}
+
+// Load is like Read, but leaves the table backed by data, which the
+// caller must not modify while the table is in use. Returns the
+// number of bytes of data used by the table.
+func (t *Table) Load(data []byte) (int, error) {
+	if len(data) < 8 {
+		return 0, fail(int64(len(data)), ErrTruncated, "failed to read stringtable header, got %d of 8 bytes", len(data))
+	}
+	count := binary.LittleEndian.Uint32(data[0:4])
+	byteLen := binary.LittleEndian.Uint32(data[4:8])
+	if err := t.checkHeader(count, byteLen); err != nil {
+		return 0, err
+	}
+	if uint64(len(data)-8) < uint64(byteLen) {
+		return 0, fail(int64(len(data)), ErrTruncated, "failed to read stringtable, got %d of %d bytes", len(data)-8, byteLen)
+	}
+	end := 8 + int(byteLen)
+	data = data[8:end]
+
+	offsets := []int{}
+	for i, off := uint32(0), 0; i < count; i++ {
+		if off > len(data) {
+			return 0, fail(int64(end), ErrMalformed, "stringtable claims %d strings, but its %d bytes only hold %d", count, byteLen, i)
+		}
+		offsets = append(offsets, off)
+		n := bytes.IndexByte(data[off:], 0)
+		if n < 0 {
+			n = len(data) - off
+		}
+		off += n + 1
+	}
+
+	t.strings = nil
+	t.index = nil
+	t.data = data
+	t.offsets = offsets
+
+	return end, nil
+}
+
+// Offsets gives where each string starts, counting from the start of
+// the table header. Only tables from Load have them.
+func (t *Table) Offsets() []int {
+	offsets := []int{}
+	for _, off := range t.offsets {
+		offsets = append(offsets, 8+off)
+	}
+	return offsets
+}
+
+func (t *Table) entry(i int) string {
+	s := t.data[t.offsets[i]:]
+	if n := bytes.IndexByte(s, 0); n >= 0 {
+		s = s[:n]
+	}
+	return string(s)
+}
+
+// Decode everything out of a lazy table, so it can be modified
+func (t *Table) materialize() {
+	if t.data == nil {
+		return
+	}
+	t.strings = t.all()
+	t.data = nil
+	t.offsets = nil
+	t.reindex()
+}
+
+func (t *Table) all() []string {
+	if t.data == nil {
+		return t.strings
+	}
+	ss := make([]string, len(t.offsets))
+	for i := range t.offsets {
+		ss[i] = t.entry(i)
+	}
+	return ss
+}
+
+func (t *Table) Len() int {
+	if t.data != nil {
+		return len(t.offsets)
+	}
+	return len(t.strings)
 }
 
 func writeU32(w io.Writer, i int) error {
@@ -56,19 +193,20 @@ func writeU32(w io.Writer, i int) error {
 
 func (t *Table) Write(rw io.Writer) error {
 	w := bufio.NewWriter(rw)
-	if err := writeU32(w, len(t.strings)); err != nil {
+	ss := t.all()
+	if err := writeU32(w, len(ss)); err != nil {
 		return err
 	}
 
 	l := 0
-	for _, s := range t.strings {
+	for _, s := range ss {
 		l += len(s) + 1
 	}
 	if err := writeU32(w, l); err != nil {
 		return err
 	}
 
-	for _, s := range t.strings {
+	for _, s := range ss {
 		w.WriteString(s)
 		w.WriteByte(0)
 	}
@@ -85,10 +223,11 @@ func (t *Table) reindex() {
 }
 
 func (t *Table) Summary() string {
-	return fmt.Sprintf("stringtable<len %d>", len(t.strings))
+	return fmt.Sprintf("stringtable<len %d>", t.Len())
 }
 
 func (t *Table) FindOrAdd(v string) int {
+	t.materialize()
 	if i, ok := t.index[v]; ok {
 		return i
 	}
@@ -99,6 +238,7 @@ func (t *Table) FindOrAdd(v string) int {
 }
 
 func (t *Table) Add(v string) int {
+	t.materialize()
 	i := len(t.strings)
 	t.strings = append(t.strings, v)
 	t.index[v] = i
@@ -106,11 +246,14 @@ func (t *Table) Add(v string) int {
 }
 
 func (t *Table) Get(i int) string {
+	if t.data != nil {
+		return t.entry(i)
+	}
 	return t.strings[i]
 }
 
 func (t *Table) Hash(w io.Writer, sorted bool) {
-	ss := t.strings
+	ss := t.all()
 	if sorted {
 		ss = append(ss[:0:0], ss...)
 		sort.Strings(ss)
@@ -0,0 +1,167 @@
+package stringtable
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+var sample = []string{"hello", "", "wörld", "last"}
+
+func encode(t *testing.T, ss []string) []byte {
+	t.Helper()
+	table := New()
+	for _, s := range ss {
+		table.Add(s)
+	}
+	var b bytes.Buffer
+	if err := table.Write(&b); err != nil {
+		t.Fatal(err)
+	}
+	return b.Bytes()
+}
+
+func load(t *testing.T, data []byte) *Table {
+	t.Helper()
+	table := New()
+	n, err := table.Load(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != len(data) {
+		t.Errorf("loaded %d of %d bytes", n, len(data))
+	}
+	return table
+}
+
+func checkStrings(t *testing.T, table *Table, want []string) {
+	t.Helper()
+	if table.Len() != len(want) {
+		t.Fatalf("table has %d strings, want %d", table.Len(), len(want))
+	}
+	for i, s := range want {
+		if got := table.Get(i); got != s {
+			t.Errorf("string %d is %q, want %q", i, got, s)
+		}
+	}
+}
+
+func TestReadAndLoadAgree(t *testing.T) {
+	data := encode(t, sample)
+
+	read := New()
+	if err := read.Read(bytes.NewReader(data)); err != nil {
+		t.Fatal(err)
+	}
+	checkStrings(t, read, sample)
+	checkStrings(t, load(t, data), sample)
+
+	if got, want := load(t, data).Offsets(), []int{8, 14, 15, 22}; !equalInts(got, want) {
+		t.Errorf("offsets are %v, want %v", got, want)
+	}
+}
+
+// A lazy table answers lookups from its data until it is modified, and
+// then from the strings decoded out of it
+func TestLazyFindOrAdd(t *testing.T) {
+	data := encode(t, sample)
+	table := load(t, data)
+
+	if i := table.FindOrAdd("wörld"); i != 2 {
+		t.Errorf("found wörld at %d, want 2", i)
+	}
+	if i := table.FindOrAdd("new"); i != len(sample) {
+		t.Errorf("added new at %d, want %d", i, len(sample))
+	}
+	if i := table.FindOrAdd("new"); i != len(sample) {
+		t.Errorf("found new at %d, want %d", i, len(sample))
+	}
+	checkStrings(t, table, append(append([]string{}, sample...), "new"))
+	if len(table.Offsets()) != 0 {
+		t.Errorf("a modified table still has offsets")
+	}
+
+	// Nothing in the data changed
+	checkStrings(t, load(t, data), sample)
+
+	var b bytes.Buffer
+	if err := table.Write(&b); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(b.Bytes(), encode(t, append(append([]string{}, sample...), "new"))) {
+		t.Errorf("wrote %q", b.Bytes())
+	}
+}
+
+// Hashing doesn't depend on whether the table is lazy
+func TestLazyHash(t *testing.T) {
+	data := encode(t, sample)
+	read := New()
+	if err := read.Read(bytes.NewReader(data)); err != nil {
+		t.Fatal(err)
+	}
+	for _, sorted := range []bool{false, true} {
+		var a, b bytes.Buffer
+		read.Hash(&a, sorted)
+		load(t, data).Hash(&b, sorted)
+		if a.String() != b.String() {
+			t.Errorf("hashed %s and %s", a.String(), b.String())
+		}
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	data := encode(t, sample)
+	for n := 0; n < len(data); n++ {
+		_, err := New().Load(data[:n])
+		if !errors.Is(err, ErrTruncated) {
+			t.Errorf("cut to %d bytes: got %v, want %v", n, err, ErrTruncated)
+		}
+	}
+
+	for name, table := range map[string]*Table{
+		"count": {MaxCount: 3},
+		"bytes": {MaxBytes: 10},
+	} {
+		if _, err := table.Load(data); !errors.Is(err, ErrLimitExceeded) {
+			t.Errorf("%s: got %v, want %v", name, err, ErrLimitExceeded)
+		}
+	}
+}
+
+func TestReadPartial(t *testing.T) {
+	data := encode(t, sample)
+	table := New()
+	err := table.ReadPartial(bytes.NewReader(data[:len(data)-2]))
+	if !errors.Is(err, ErrTruncated) {
+		t.Errorf("got %v, want %v", err, ErrTruncated)
+	}
+	checkStrings(t, table, sample[:3])
+}
+
+func equalInts(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// More strings than the bytes could hold is a bad header, not a short file
+func TestMalformedHeader(t *testing.T) {
+	for _, data := range [][]byte{
+		{5, 0, 0, 0, 2, 0, 0, 0, 'a', 0},
+		{4, 0, 0, 0, 4, 0, 0, 0, 'a', 0, 'b', 0},
+	} {
+		if _, err := New().Load(data); !errors.Is(err, ErrMalformed) {
+			t.Errorf("Load %v: got %v, want %v", data, err, ErrMalformed)
+		}
+		if err := New().Read(bytes.NewReader(data)); !errors.Is(err, ErrMalformed) {
+			t.Errorf("Read %v: got %v, want %v", data, err, ErrMalformed)
+		}
+	}
+}